@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+)
+
+// alertLargest is how many of the largest objects are printed when the total
+// size crosses -alert-total-size, to show where the bytes went.
+const alertLargest = 10
+
+// alertWriter checks the listing against -alert-object-size and
+// -alert-total-size for a scheduled monitoring check. It writes nothing to w
+// unless an alert is raised, then writes the offending objects when closed:
+// those larger than -alert-object-size, or else the largest ones.
+type alertWriter struct {
+	w         objectWriter
+	offenders []object
+	largest   []object
+	total     int64
+
+	// alerts are the alert messages, set once closed.
+	alerts []string
+}
+
+func newAlertWriter(w objectWriter) *alertWriter {
+	return &alertWriter{w: w}
+}
+
+func (a *alertWriter) Write(obj object) error {
+	size := *obj.Size
+	a.total += size
+	if alertObjectSize >= 0 && size > alertObjectSize {
+		a.offenders = append(a.offenders, obj)
+	}
+	a.largest = append(a.largest, obj)
+	if len(a.largest) > 2*alertLargest {
+		a.keepLargest()
+	}
+	return nil
+}
+
+// keepLargest sorts the largest objects kept and drops those beyond
+// alertLargest.
+func (a *alertWriter) keepLargest() {
+	slices.SortStableFunc(a.largest, objectOrders["size"])
+	a.largest = a.largest[:min(len(a.largest), alertLargest)]
+}
+
+// WritePrefix drops the common prefixes, only the objects raise alerts.
+func (a *alertWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (a *alertWriter) Close() error {
+	if len(a.offenders) > 0 {
+		a.alerts = append(a.alerts, fmt.Sprintf("%d objects larger than %s in %s", len(a.offenders), byteCountIEC(alertObjectSize), targetDescription()))
+	}
+	if alertTotalSize >= 0 && a.total > alertTotalSize {
+		a.alerts = append(a.alerts, fmt.Sprintf("the objects of %s total %s, more than %s", targetDescription(), byteCountIEC(a.total), byteCountIEC(alertTotalSize)))
+	}
+
+	show := a.offenders
+	if len(show) == 0 && len(a.alerts) > 0 {
+		a.keepLargest()
+		show = a.largest
+	}
+	slices.SortStableFunc(show, objectOrders["size"])
+	for _, obj := range show {
+		if err := a.w.Write(obj); err != nil {
+			return err
+		}
+	}
+	return a.w.Close()
+}
+
+// report logs the alerts and reports whether there were any, or logs that
+// the check passed unless -quiet is set.
+func (a *alertWriter) report() bool {
+	for _, alert := range a.alerts {
+		log.Println("ALERT:", alert)
+	}
+	if len(a.alerts) == 0 && !quiet {
+		log.Printf("OK: %s holds %s within the alert thresholds", targetDescription(), byteCountIEC(a.total))
+	}
+	return len(a.alerts) > 0
+}
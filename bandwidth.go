@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// throttleChunk is the most a throttled read reads at once, so that the
+// concurrent downloads share the bandwidth in small turns.
+const throttleChunk = 32 * 1024
+
+// bandwidth is the -bandwidth-limit limiter, shared by every download, nil
+// without a limit.
+var bandwidth *bandwidthLimiter
+
+// parseBandwidth parses a -bandwidth-limit rate such as 10MB/s, the /s being
+// optional, into bytes per second.
+func parseBandwidth(s string) (float64, error) {
+	var size datasize.ByteSize
+	if err := size.UnmarshalText([]byte(strings.TrimSuffix(s, "/s"))); err != nil {
+		return 0, fmt.Errorf("expected a rate such as 10MB/s, got %q", s)
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("the rate must be positive, got %q", s)
+	}
+	return float64(size.Bytes()), nil
+}
+
+// bandwidthLimiter spaces the reads so that their bytes add up to at most
+// rate per second. It does not save unused bandwidth for a later burst.
+type bandwidthLimiter struct {
+	rate float64
+
+	mu sync.Mutex
+	// next is when the bytes read so far are all within the rate.
+	next time.Time
+}
+
+// wait accounts for n bytes read, sleeping until they are within the rate.
+func (b *bandwidthLimiter) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(float64(n) / b.rate * float64(time.Second)))
+	until := b.next
+	b.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// throttledReader reads from r within the bandwidth of limiter.
+type throttledReader struct {
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p[:min(len(p), throttleChunk)])
+	t.limiter.wait(n)
+	return n, err
+}
+
+// throttle returns r limited to -bandwidth-limit, or r itself without a
+// limit.
+func throttle(r io.Reader) io.Reader {
+	if bandwidth == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: bandwidth}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// printBucketInfo prints the region, versioning, default encryption, public
+// access block and policy status of bucket.
+func printBucketInfo(ctx context.Context, w io.Writer, cfg aws.Config, bucket string) error {
+	region, err := bucketRegion(ctx, cfg, bucket)
+	if err != nil {
+		return err
+	}
+	client := regionClient(cfg, region)
+
+	versioning, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: &bucket})
+	if err != nil {
+		return err
+	}
+	versioningStatus := "never enabled"
+	if versioning.Status != "" {
+		versioningStatus = string(versioning.Status)
+		if versioning.MFADelete != "" {
+			versioningStatus += ", MFA delete " + string(versioning.MFADelete)
+		}
+	}
+
+	encryptionStatus := "none"
+	encryption, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: &bucket})
+	switch {
+	case isAPIError(err, "ServerSideEncryptionConfigurationNotFoundError"):
+	case err != nil:
+		return err
+	case encryption.ServerSideEncryptionConfiguration != nil:
+		var rules []string
+		for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+			if d := rule.ApplyServerSideEncryptionByDefault; d != nil {
+				s := string(d.SSEAlgorithm)
+				if d.KMSMasterKeyID != nil {
+					s += " " + *d.KMSMasterKeyID
+				}
+				rules = append(rules, s)
+			}
+		}
+		if len(rules) > 0 {
+			encryptionStatus = strings.Join(rules, ", ")
+		}
+	}
+
+	publicAccessStatus := "not configured"
+	publicAccess, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: &bucket})
+	switch {
+	case isAPIError(err, "NoSuchPublicAccessBlockConfiguration"):
+	case err != nil:
+		return err
+	case publicAccess.PublicAccessBlockConfiguration != nil:
+		c := publicAccess.PublicAccessBlockConfiguration
+		publicAccessStatus = fmt.Sprintf("BlockPublicAcls=%t IgnorePublicAcls=%t BlockPublicPolicy=%t RestrictPublicBuckets=%t",
+			aws.ToBool(c.BlockPublicAcls), aws.ToBool(c.IgnorePublicAcls), aws.ToBool(c.BlockPublicPolicy), aws.ToBool(c.RestrictPublicBuckets))
+	}
+
+	policyStatus := "no policy"
+	policy, err := client.GetBucketPolicyStatus(ctx, &s3.GetBucketPolicyStatusInput{Bucket: &bucket})
+	switch {
+	case isAPIError(err, "NoSuchBucketPolicy"):
+	case err != nil:
+		return err
+	case policy.PolicyStatus != nil && aws.ToBool(policy.PolicyStatus.IsPublic):
+		policyStatus = "public"
+	default:
+		policyStatus = "not public"
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+	fmt.Fprintf(w, "bucket:              %s\n", bucket)
+	fmt.Fprintf(w, "region:              %s\n", region)
+	fmt.Fprintf(w, "versioning:          %s\n", versioningStatus)
+	fmt.Fprintf(w, "default encryption:  %s\n", encryptionStatus)
+	fmt.Fprintf(w, "public access block: %s\n", publicAccessStatus)
+	fmt.Fprintf(w, "bucket policy:       %s\n", policyStatus)
+	return nil
+}
+
+// isAPIError reports whether err is an S3 error with the given code.
+func isAPIError(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
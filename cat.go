@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// catSniffSize is how much of an object is looked at to tell whether it is
+// binary.
+const catSniffSize = 8 * 1024
+
+// fetchContent is the enricher fetching the content of obj for -cat. The
+// objects larger than -cat-max or that look binary are left without content
+// and with the reason, unless -cat-force is set.
+func fetchContent(ctx context.Context, client *s3.Client, obj *object) error {
+	if aws.ToInt64(obj.Size) > catMax && !catForce {
+		obj.catSkipped = fmt.Sprintf("larger than -cat-max %s", byteCountIEC(catMax))
+		return nil
+	}
+	input := &s3.GetObjectInput{Bucket: &obj.bucket, Key: obj.Key}
+	if obj.versionID != "" {
+		input.VersionId = &obj.versionID
+	}
+	response, err := client.GetObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", *obj.Key, err)
+	}
+	defer response.Body.Close()
+	if obj.content, err = io.ReadAll(throttle(response.Body)); err != nil {
+		return fmt.Errorf("failed to read %s: %w", *obj.Key, err)
+	}
+	if isBinary(obj.content) && !catForce {
+		obj.content, obj.catSkipped = nil, "binary"
+	}
+	return nil
+}
+
+// isBinary reports whether content looks binary: its beginning holds a NUL
+// byte or is not valid UTF-8.
+func isBinary(content []byte) bool {
+	sniff := content[:min(len(content), catSniffSize)]
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return true
+	}
+	if len(sniff) < len(content) {
+		// The sniffed part may end in the middle of a character.
+		for i := 1; i < utf8.UTFMax && !utf8.Valid(sniff); i++ {
+			sniff = sniff[:len(sniff)-1]
+		}
+	}
+	return !utf8.Valid(sniff)
+}
+
+// catWriter prints the content of each object after a header line with its
+// URI, in the listing order.
+type catWriter struct {
+	w       io.WriteCloser
+	written bool
+}
+
+func (c *catWriter) Write(obj object) error {
+	uri := fmt.Sprintf("s3://%s/%s", obj.bucket, *obj.Key)
+	if obj.catSkipped != "" {
+		if !quiet {
+			log.Printf("note: not printing %s, %s, use -cat-force to print it anyway", uri, obj.catSkipped)
+		}
+		return nil
+	}
+	if c.written {
+		fmt.Fprintln(c.w)
+	}
+	c.written = true
+	fmt.Fprintf(c.w, "==> %s <==\n", uri)
+	if _, err := c.w.Write(obj.content); err != nil {
+		return err
+	}
+	if len(obj.content) > 0 && obj.content[len(obj.content)-1] != '\n' {
+		fmt.Fprintln(c.w)
+	}
+	return nil
+}
+
+// WritePrefix drops the common prefixes, they have no content.
+func (c *catWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (c *catWriter) Close() error {
+	return c.w.Close()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// loadConfig loads the shared AWS configuration, using the -profile profile
+// when set, else the AWS_PROFILE one, else the default one. Profiles relying
+// on credential_process, SSO or assume-role are resolved by the SDK
+// credential chain, unless -no-sign-request makes the requests anonymous.
+// With -role-arn and -web-identity-token-file, the credentials are those of
+// the role assumed with the web identity token, like the SDK does from
+// AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE. The regional clients are all
+// built from this configuration by newClient, so the profile or role applies
+// to every request.
+func loadConfig(ctx context.Context) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if noSignRequest {
+		opts = append(opts, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+	if httpTimeout > 0 {
+		opts = append(opts, config.WithHTTPClient(newHTTPClient(httpTimeout)))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil || roleARN == "" {
+		return cfg, err
+	}
+	// STS is reachable from any region, and the token file is read again
+	// each time the credentials are renewed, as the token rotates.
+	stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if o.Region == "" {
+			o.Region = "us-east-1"
+		}
+	})
+	provider := stscreds.NewWebIdentityRoleProvider(stsClient, roleARN, stscreds.IdentityTokenFile(webIdentityToken),
+		func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = cmp.Or(os.Getenv("AWS_ROLE_SESSION_NAME"), "lsb")
+		})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return cfg, nil
+}
+
+// newHTTPClient returns the SDK HTTP client with timeout bounding the
+// connection and the wait for the response headers. The bodies, which can be
+// large downloads or uploads, are not bounded. Like the default client, it
+// honors the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func newHTTPClient(timeout time.Duration) *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = timeout
+		}).
+		WithTransportOptions(func(tr *http.Transport) {
+			tr.ResponseHeaderTimeout = timeout
+		})
+}
+
+// newClient returns an S3 client for region. This is the only place clients
+// are built: cfg is never mutated, so the credentials and options loaded by
+// loadConfig are kept by every client.
+func newClient(cfg aws.Config, region string) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+		if printRequestIDs {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Deserialize.Add(logRequestIDs, middleware.Before)
+			})
+		}
+	})
+}
+
+// logRequestIDs is the middleware of -print-request-ids, logging the request
+// IDs AWS support asks for of each S3 response that is an error, retries
+// included. Being first in the deserialize step, it sees the errors the
+// operation deserializer made of the responses.
+var logRequestIDs = middleware.DeserializeMiddlewareFunc("LogRequestIDs", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+	out, md, err := next.HandleDeserialize(ctx, in)
+	if resp, ok := out.RawResponse.(*smithyhttp.Response); ok && err != nil && resp.StatusCode != 0 {
+		log.Printf("%s failed with HTTP %d: x-amz-request-id %s, x-amz-id-2 %s", middleware.GetOperationName(ctx),
+			resp.StatusCode, resp.Header.Get("x-amz-request-id"), resp.Header.Get("x-amz-id-2"))
+	}
+	return out, md, err
+})
+
+// newBucketClient returns an S3 client for the region bucket lives in, taken
+// from -bucket-regions when listed there, else looked up. A note is logged,
+// unless -quiet is set, when a looked up region differs from the configured
+// region, if any, by bucketRegion.
+func newBucketClient(ctx context.Context, cfg aws.Config, bucket string) (*s3.Client, error) {
+	if region, ok := bucketRegions[bucket]; ok {
+		return regionClient(cfg, region), nil
+	}
+	region, err := bucketRegion(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return regionClient(cfg, region), nil
+}
+
+// regionClients are the clients built by regionClient, by region.
+var (
+	regionClientsMu sync.Mutex
+	regionClients   = map[string]*s3.Client{}
+)
+
+// regionClient returns the client for region, building it on first use so
+// that the buckets of a region share it. The configuration is the same for
+// the whole run, so it is not part of the cache key.
+func regionClient(cfg aws.Config, region string) *s3.Client {
+	regionClientsMu.Lock()
+	defer regionClientsMu.Unlock()
+	client, ok := regionClients[region]
+	if !ok {
+		client = newClient(cfg, region)
+		regionClients[region] = client
+	}
+	return client
+}
+
+// parseBucketRegions parses the -bucket-regions list of bucket=region pairs,
+// returning the regions by bucket and the buckets in the listed order.
+func parseBucketRegions(value string) (map[string]string, []string, error) {
+	regions := map[string]string{}
+	var buckets []string
+	for _, pair := range strings.Split(value, ",") {
+		bucket, region, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || bucket == "" || region == "" {
+			return nil, nil, fmt.Errorf("expected bucket=region, got %q", pair)
+		}
+		if _, ok := regions[bucket]; ok {
+			return nil, nil, fmt.Errorf("bucket %s is listed twice", bucket)
+		}
+		regions[bucket] = region
+		buckets = append(buckets, bucket)
+	}
+	return regions, buckets, nil
+}
+
+// lookedUpRegions caches the regions found by bucketRegion, by bucket.
+var (
+	lookedUpRegionsMu sync.Mutex
+	lookedUpRegions   = map[string]string{}
+)
+
+// bucketRegion returns the region of bucket, looking it up once and then
+// logging the note of newBucketClient, so that it is logged once per bucket.
+// Anonymous requests are not allowed to look it up, so with
+// -no-sign-request it is the -region one.
+func bucketRegion(ctx context.Context, cfg aws.Config, bucket string) (string, error) {
+	if noSignRequest {
+		return cfg.Region, nil
+	}
+	lookedUpRegionsMu.Lock()
+	region, ok := lookedUpRegions[bucket]
+	lookedUpRegionsMu.Unlock()
+	if ok {
+		return region, nil
+	}
+
+	response, err := regionClient(cfg, "").GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: &bucket,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get bucket location: %w", err)
+	}
+	region = constraintRegion(response.LocationConstraint)
+	lookedUpRegionsMu.Lock()
+	_, ok = lookedUpRegions[bucket]
+	lookedUpRegions[bucket] = region
+	lookedUpRegionsMu.Unlock()
+	// Another lookup of bucket may have finished first and logged it.
+	if !ok && !quiet && region != "" && cfg.Region != "" && region != cfg.Region {
+		log.Printf("note: bucket %s is in region %s, not in the configured region %s", bucket, region, cfg.Region)
+	}
+	return region, nil
+}
+
+// constraintRegion returns the region of a bucket location constraint. The
+// buckets of us-east-1 have an empty constraint, and the oldest buckets of
+// eu-west-1 have the legacy EU one; neither is a region the client can be
+// built for.
+func constraintRegion(constraint types.BucketLocationConstraint) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	}
+	return string(constraint)
+}
+
+// prefetchRegions looks up the regions of buckets not in -bucket-regions,
+// up to -concurrency at once, so that the many buckets of a fleet-wide run
+// do not wait on each other's lookups. The failed lookups are left to be
+// reported when the bucket is listed.
+func prefetchRegions(ctx context.Context, cfg aws.Config, buckets []string) {
+	forEach(len(buckets), func(i int) error {
+		if _, ok := bucketRegions[buckets[i]]; !ok {
+			bucketRegion(ctx, cfg, buckets[i])
+		}
+		return nil
+	})
+}
+
+// matchingBuckets returns the names of the buckets matching re.
+func matchingBuckets(ctx context.Context, cfg aws.Config, re *regexp.Regexp) ([]string, error) {
+	var buckets []string
+	paginator := s3.NewListBucketsPaginator(newClient(cfg, ""), &s3.ListBucketsInput{})
+	for paginator.HasMorePages() {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range page.Buckets {
+			if re.MatchString(*b.Name) {
+				buckets = append(buckets, *b.Name)
+			}
+		}
+	}
+	return buckets, nil
+}
+
+// isSSOExpired reports whether err is caused by an expired, invalid or
+// missing SSO session. The error message is checked as well as the error
+// type, as the SDK does not wrap every SSO token error in InvalidTokenError.
+func isSSOExpired(err error) bool {
+	var tokenErr *ssocreds.InvalidTokenError
+	if errors.As(err, &tokenErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "sso") &&
+		(strings.Contains(msg, "expired") ||
+			strings.Contains(msg, "refresh cached sso token failed") ||
+			strings.Contains(msg, "failed to read cached sso token"))
+}
+
+// ssoLoginHint returns the command refreshing the SSO session of the profile
+// in use.
+func ssoLoginHint() string {
+	name := profile
+	if name == "" {
+		name = os.Getenv("AWS_PROFILE")
+	}
+	if name == "" {
+		return "aws sso login"
+	}
+	return "aws sso login --profile " + name
+}
+
+// credentialsMargin is how long the credentials must stay valid when a
+// deletion starts for it not to warn about their expiry.
+const credentialsMargin = 15 * time.Minute
+
+// credentialsExpiry is when the temporary credentials of a deletion expire,
+// zero when they do not, set by checkCredentialsExpiry.
+var credentialsExpiry time.Time
+
+// checkCredentialsExpiry retrieves the credentials before a deletion and
+// warns when they are temporary and expire within credentialsMargin, as a
+// deletion failing halfway leaves the listing to be run again. The providers
+// able to renew them, like assume-role, do so when they expire, but the
+// temporary credentials of the environment or of a credential_process cannot
+// be renewed. A failed retrieval is left to be reported by the first request.
+func checkCredentialsExpiry(ctx context.Context, cfg aws.Config) {
+	if noSignRequest || cfg.Credentials == nil {
+		return
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil || !creds.CanExpire {
+		return
+	}
+	credentialsExpiry = creds.Expires
+	if left := time.Until(creds.Expires); left < credentialsMargin {
+		log.Printf("warning: the credentials expire in %s, %s", left.Round(time.Second), credentialsExpiryHint)
+	} else if !quiet {
+		log.Printf("note: the credentials expire at %s, in %s", creds.Expires.Local().Format(time.DateTime), left.Round(time.Minute))
+	}
+}
+
+// credentialsExpiryHint tells how to keep the credentials from expiring
+// during a deletion.
+const credentialsExpiryHint = "the deletion may fail halfway, refresh them or use a role with a longer session duration"
+
+// warnedExpiry is set once checkDeletionPace warned that the deletion would
+// outlast the credentials.
+var warnedExpiry atomic.Bool
+
+// deletionStart is when the deletion of the versions started, once
+// confirmed, and deletionPages counts the pages of versions deleted since.
+var (
+	deletionStart time.Time
+	deletionPages atomic.Int64
+)
+
+// checkDeletionPace is called after the versions of each page are deleted,
+// truncated telling whether the listing has more pages. It warns once when,
+// at the rate of the versions deleted so far, the deletion would still be
+// running when the credentials expire. The versions left are those of the
+// exact preview count when known, else at least another page.
+func checkDeletionPace(truncated bool) {
+	pages := deletionPages.Add(1)
+	deleted := deletedVersions.Load()
+	if credentialsExpiry.IsZero() || warnedExpiry.Load() || deleted == 0 {
+		return
+	}
+	elapsed := time.Since(deletionStart)
+	var eta time.Duration
+	needs := "about"
+	switch {
+	case deleteEstimate > deleted:
+		eta = time.Duration(float64(deleteEstimate-deleted) / float64(deleted) * float64(elapsed))
+	case truncated:
+		eta, needs = elapsed/time.Duration(pages), "at least"
+	default:
+		return
+	}
+	if !time.Now().Add(eta).After(credentialsExpiry) || warnedExpiry.Swap(true) {
+		return
+	}
+	log.Printf("warning: at the current rate, the deletion needs %s %s more but the credentials expire in %s, %s",
+		needs, eta.Round(time.Second), time.Until(credentialsExpiry).Round(time.Second), credentialsExpiryHint)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// TestRegionClientKeepsConfig checks that the client rebuilt for the region
+// a bucket lives in keeps the credentials and options loaded by loadConfig,
+// without changing the configuration the other clients are built from.
+func TestRegionClientKeepsConfig(t *testing.T) {
+	httpClient := &http.Client{}
+	cfg := aws.Config{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("AKID", "SECRET", "TOKEN"),
+		HTTPClient:       httpClient,
+		RetryMaxAttempts: 7,
+		BaseEndpoint:     aws.String("http://localhost:9000"),
+	}
+	regionClientsMu.Lock()
+	saved := regionClients
+	regionClients = map[string]*s3.Client{}
+	regionClientsMu.Unlock()
+	t.Cleanup(func() { regionClients = saved })
+
+	client := regionClient(cfg, "eu-west-1")
+	o := client.Options()
+	if o.Region != "eu-west-1" {
+		t.Errorf("region = %q, want eu-west-1", o.Region)
+	}
+	if cfg.Region != "us-east-1" {
+		t.Errorf("the configuration was changed to region %q", cfg.Region)
+	}
+	creds, err := o.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "SECRET" || creds.SessionToken != "TOKEN" {
+		t.Errorf("credentials = %+v, want the static ones", creds)
+	}
+	if o.HTTPClient != httpClient {
+		t.Error("the HTTP client was not kept")
+	}
+	if o.RetryMaxAttempts != 7 {
+		t.Errorf("RetryMaxAttempts = %d, want 7", o.RetryMaxAttempts)
+	}
+	if aws.ToString(o.BaseEndpoint) != "http://localhost:9000" {
+		t.Errorf("BaseEndpoint = %q, want http://localhost:9000", aws.ToString(o.BaseEndpoint))
+	}
+	if regionClient(cfg, "eu-west-1") != client {
+		t.Error("the client of the region was built twice")
+	}
+}
+
+func TestConstraintRegion(t *testing.T) {
+	tests := []struct {
+		constraint types.BucketLocationConstraint
+		want       string
+	}{
+		{"", "us-east-1"},
+		{types.BucketLocationConstraintEu, "eu-west-1"},
+		{types.BucketLocationConstraintEuWest3, "eu-west-3"},
+		{types.BucketLocationConstraintApSoutheast2, "ap-southeast-2"},
+	}
+	for _, tt := range tests {
+		if got := constraintRegion(tt.constraint); got != tt.want {
+			t.Errorf("constraintRegion(%q) = %q, want %q", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+// TestLoadConfigProfile checks that -profile takes precedence over
+// AWS_PROFILE, which takes precedence over the default profile.
+func TestLoadConfigProfile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte(`[default]
+region = us-east-1
+aws_access_key_id = DEFAULT
+aws_secret_access_key = secret
+
+[profile env]
+region = eu-west-1
+aws_access_key_id = ENV
+aws_secret_access_key = secret
+
+[profile flag]
+region = ap-south-1
+aws_access_key_id = FLAG
+aws_secret_access_key = secret
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, flag, env string
+		wantRegion      string
+		wantKey         string
+	}{
+		{name: "flag only", flag: "flag", wantRegion: "ap-south-1", wantKey: "FLAG"},
+		{name: "env only", env: "env", wantRegion: "eu-west-1", wantKey: "ENV"},
+		{name: "both set", flag: "flag", env: "env", wantRegion: "ap-south-1", wantKey: "FLAG"},
+		{name: "neither set", wantRegion: "us-east-1", wantKey: "DEFAULT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_CONFIG_FILE", configFile)
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+			for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_DEFAULT_PROFILE"} {
+				t.Setenv(name, "")
+			}
+			t.Setenv("AWS_PROFILE", tt.env)
+			profile = tt.flag
+			defer func() { profile = "" }()
+
+			cfg, err := loadConfig(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Region != tt.wantRegion {
+				t.Errorf("region = %q, want %q", cfg.Region, tt.wantRegion)
+			}
+			creds, err := cfg.Credentials.Retrieve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyID != tt.wantKey {
+				t.Errorf("access key = %q, want %q", creds.AccessKeyID, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The palettes -color-mode selects.
+const (
+	paletteTrueColor = "truecolor"
+	palette256       = "256"
+	palette16        = "16"
+)
+
+// palette is the palette the colors are written in, set from -color-mode.
+var palette = paletteTrueColor
+
+// detectPalette returns the palette the terminal supports according to
+// COLORTERM and TERM. Terminals only advertise 24-bit support in COLORTERM,
+// so the others get the 256 colors their TERM claims or else the 16 basic
+// ones.
+func detectPalette() string {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return paletteTrueColor
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return palette256
+	}
+	return palette16
+}
+
+// cubeLevels are the component values of the 6x6x6 color cube of the 256
+// colors palette, from code 16 on.
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// basicColors are the usual RGB values of the 16 basic colors, from black to
+// bright white, written as codes 30 to 37 and 90 to 97.
+var basicColors = [16]Color{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// distance returns the squared distance between c and o.
+func (c Color) distance(o Color) int {
+	r, g, b := c.R-o.R, c.G-o.G, c.B-o.B
+	return r*r + g*g + b*b
+}
+
+// code256 returns the code of the 256 colors palette closest to c, from the
+// color cube or the grayscale ramp of codes 232 to 255.
+func (c Color) code256() int {
+	nearestLevel := func(v int) int {
+		best := 0
+		for i, level := range cubeLevels {
+			if abs(v-level) < abs(v-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := nearestLevel(c.R), nearestLevel(c.G), nearestLevel(c.B)
+	code := 16 + 36*r + 6*g + b
+	cube := Color{cubeLevels[r], cubeLevels[g], cubeLevels[b]}
+
+	gray := min(23, max(0, ((c.R+c.G+c.B)/3-8+5)/10))
+	level := 8 + 10*gray
+	if c.distance(Color{level, level, level}) < c.distance(cube) {
+		return 232 + gray
+	}
+	return code
+}
+
+// code16 returns the SGR code of the basic color closest to c.
+func (c Color) code16() int {
+	best := 0
+	for i, basic := range basicColors {
+		if c.distance(basic) < c.distance(basicColors[best]) {
+			best = i
+		}
+	}
+	if best < 8 {
+		return 30 + best
+	}
+	return 90 + best - 8
+}
+
+func (c Color) String() string {
+	switch palette {
+	case palette256:
+		return fmt.Sprintf("\033[38;5;%dm", c.code256())
+	case palette16:
+		return fmt.Sprintf("\033[%dm", c.code16())
+	}
+	return fmt.Sprintf("\033[38;2;%d;%d;%dm", c.R, c.G, c.B)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
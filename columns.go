@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnNames are the columns -columns can select.
+var columnNames = []string{"bucket", "key", "size", "modified", "class", "etag", "version"}
+
+// defaultCSVColumns are the columns of the CSV and TSV outputs without
+// -columns.
+var defaultCSVColumns = []string{"bucket", "key", "size", "modified", "class", "etag"}
+
+// parseColumns parses a comma-separated list of column names.
+func parseColumns(s string) ([]string, error) {
+	var columns []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(columnNames, name) {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", name, strings.Join(columnNames, ", "))
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// columnValue returns the machine-readable value of column for obj.
+func columnValue(obj object, column string) string {
+	switch column {
+	case "bucket":
+		return obj.bucket
+	case "key":
+		return displayKey(obj.bucket, *obj.Key)
+	case "size":
+		return strconv.FormatInt(*obj.Size, 10)
+	case "modified":
+		return obj.LastModified.UTC().Format(time.RFC3339)
+	case "class":
+		return string(obj.StorageClass)
+	case "etag":
+		return newObjectRecord(obj).ETag
+	case "version":
+		return obj.versionID
+	}
+	return ""
+}
+
+// textColumn returns the value of column for obj as the text output prints
+// it.
+func (t *textWriter) textColumn(obj object, column string) string {
+	switch column {
+	case "size":
+		return fmt.Sprintf("%*s", t.sizeWidth, byteCountIEC(*obj.Size))
+	case "modified":
+		if relativeTime {
+			return fmt.Sprintf("%*s", len(time.DateTime), humanizeAge(*obj.LastModified, time.Now()))
+		}
+		return obj.LastModified.Format(time.DateTime)
+	case "key":
+		if t.isTerm {
+			return highlightFilter(columnValue(obj, column), objectColor(obj))
+		}
+	}
+	return columnValue(obj, column)
+}
+
+// csvWriter writes the objects as CSV, or TSV, rows of columns after a header
+// row. Common prefixes are written with only their key.
+type csvWriter struct {
+	w       io.WriteCloser
+	csv     *csv.Writer
+	columns []string
+	header  bool
+}
+
+func newCSVWriter(w io.WriteCloser, comma rune, columns []string) *csvWriter {
+	c := csv.NewWriter(w)
+	c.Comma = comma
+	return &csvWriter{w: w, csv: c, columns: columns}
+}
+
+func (c *csvWriter) writeRow(value func(column string) string) error {
+	if !c.header {
+		c.header = true
+		if err := c.csv.Write(c.columns); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		row[i] = value(column)
+	}
+	return c.csv.Write(row)
+}
+
+func (c *csvWriter) Write(obj object) error {
+	return c.writeRow(func(column string) string {
+		return columnValue(obj, column)
+	})
+}
+
+func (c *csvWriter) WritePrefix(bucket, prefix string) error {
+	return c.writeRow(func(column string) string {
+		switch column {
+		case "bucket":
+			return bucket
+		case "key":
+			return displayKey(bucket, prefix)
+		}
+		return ""
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if !c.header {
+		c.header = true
+		if err := c.csv.Write(c.columns); err != nil {
+			return err
+		}
+	}
+	c.csv.Flush()
+	if err := c.csv.Error(); err != nil {
+		return err
+	}
+	return c.w.Close()
+}
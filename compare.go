@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// collectWriter keeps the listed objects in memory.
+type collectWriter struct {
+	objs []object
+}
+
+func (c *collectWriter) Write(obj object) error {
+	c.objs = append(c.objs, obj)
+	return nil
+}
+
+func (c *collectWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (c *collectWriter) Close() error {
+	return nil
+}
+
+// compareBuckets lists -bucket below prefix and -other-bucket below
+// -other-prefix concurrently, then writes to out the objects only in the
+// first, those only in the other, and those of the first whose size or ETag
+// differ in the other, in this order and each sorted by key. The keys are
+// compared relative to their prefix. The matched objects of the first
+// listing are added to total.
+//
+// Like for -dedupe-etag, the ETags of multipart uploads depend on the part
+// size, so a copy made with another part size is reported as differing.
+func compareBuckets(ctx context.Context, cfg aws.Config, bucket, prefix string, out objectWriter, total *stats) error {
+	listings := [2]struct {
+		bucket, prefix string
+		objs           collectWriter
+		total          *stats
+	}{
+		{bucket: bucket, prefix: prefix, total: total},
+		{bucket: otherBucket, prefix: otherPrefix, total: newStats()},
+	}
+	err := forEach(len(listings), func(i int) error {
+		l := &listings[i]
+		client, err := newBucketClient(ctx, cfg, l.bucket)
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.bucket, err)
+		}
+		if err := listObjects(ctx, client, l.bucket, l.prefix, &l.objs, l.total); err != nil {
+			return fmt.Errorf("%s: %w", l.bucket, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	others := map[string]object{}
+	for _, obj := range listings[1].objs.objs {
+		others[strings.TrimPrefix(*obj.Key, otherPrefix)] = obj
+	}
+	var onlyHere, differing []object
+	for _, obj := range listings[0].objs.objs {
+		key := strings.TrimPrefix(*obj.Key, prefix)
+		other, ok := others[key]
+		delete(others, key)
+		switch {
+		case !ok:
+			obj.change = changeOnlyInBucket
+			onlyHere = append(onlyHere, obj)
+		case *obj.Size != *other.Size || aws.ToString(obj.ETag) != aws.ToString(other.ETag):
+			obj.change = changeDiffers
+			differing = append(differing, obj)
+		}
+	}
+	var onlyOther []object
+	for _, obj := range others {
+		obj.change = changeOnlyInOther
+		onlyOther = append(onlyOther, obj)
+	}
+
+	for _, section := range [][]object{onlyHere, onlyOther, differing} {
+		slices.SortFunc(section, objectOrders["key"])
+		for _, obj := range section {
+			if err := out.Write(obj); err != nil {
+				return err
+			}
+		}
+	}
+	if !quiet {
+		log.Printf("note: %d objects only in s3://%s/%s, %d only in s3://%s/%s, %d differing",
+			len(onlyHere), bucket, prefix, len(onlyOther), otherBucket, otherPrefix, len(differing))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// etagGroup is a set of objects sharing the same ETag.
+type etagGroup struct {
+	etag    string
+	size    int64
+	objects []object
+}
+
+// wasted returns the bytes that would be reclaimed by keeping a single copy.
+func (g *etagGroup) wasted() int64 {
+	return g.size * int64(len(g.objects)-1)
+}
+
+// dedupeWriter groups the objects by ETag and prints the groups with more
+// than one member when closed.
+//
+// The ETag of an object uploaded in a single part is the MD5 of its content,
+// but the ETag of a multipart upload (containing a "-") depends on the part
+// size, so identical content uploaded with different part sizes will not be
+// reported as duplicates.
+type dedupeWriter struct {
+	w      io.WriteCloser
+	groups map[string]*etagGroup
+}
+
+func newDedupeWriter(w io.WriteCloser) *dedupeWriter {
+	return &dedupeWriter{w: w, groups: map[string]*etagGroup{}}
+}
+
+func (d *dedupeWriter) Write(obj object) error {
+	if obj.ETag == nil {
+		return nil
+	}
+	etag := strings.Trim(*obj.ETag, `"`)
+	g, ok := d.groups[etag]
+	if !ok {
+		g = &etagGroup{etag: etag, size: *obj.Size}
+		d.groups[etag] = g
+	}
+	g.objects = append(g.objects, obj)
+	return nil
+}
+
+func (d *dedupeWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (d *dedupeWriter) Close() error {
+	var dups []*etagGroup
+	var wasted, multipart int64
+	for _, g := range d.groups {
+		if len(g.objects) > 1 {
+			dups = append(dups, g)
+			wasted += g.wasted()
+		}
+		if strings.Contains(g.etag, "-") {
+			multipart++
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].wasted() > dups[j].wasted()
+	})
+
+	for _, g := range dups {
+		fmt.Fprintf(d.w, "%s: %d copies of %s, %s wasted\n", g.etag, len(g.objects), byteCountIEC(g.size), byteCountIEC(g.wasted()))
+		for _, obj := range g.objects {
+			fmt.Fprintf(d.w, "  %s\n", displayKey(obj.bucket, *obj.Key))
+		}
+	}
+	fmt.Fprintf(d.w, "%d duplicate groups, %s wasted\n", len(dups), byteCountIEC(wasted))
+	if multipart > 0 {
+		fmt.Fprintf(d.w, "note: %d ETags are from multipart uploads and only match copies uploaded with the same part size\n", multipart)
+	}
+	return d.w.Close()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// deleteBatchSize is the most keys a DeleteObjects request accepts.
+const deleteBatchSize = 1000
+
+// listedKey is a key to delete with -delete-from-file, in a given version
+// when versionID is set.
+type listedKey struct {
+	bucket, key, versionID string
+}
+
+// readDeleteList reads the keys of -delete-from-file: from a CSV manifest of
+// bucket, URL-encoded key and optional version ID rows like the S3 Batch
+// Operations ones, or from a newline-delimited list of keys of -bucket.
+func readDeleteList(path string) ([]listedKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []listedKey
+	if strings.HasSuffix(path, ".csv") {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		for {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				return keys, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(record) < 2 || len(record) > 3 {
+				return nil, fmt.Errorf("expected bucket,key[,version_id] rows, got %q", strings.Join(record, ","))
+			}
+			key, err := url.QueryUnescape(record[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %w", record[1], err)
+			}
+			k := listedKey{bucket: record[0], key: key}
+			if len(record) == 3 {
+				k.versionID = record[2]
+			}
+			keys = append(keys, k)
+		}
+	}
+	if bucketName == "" {
+		return nil, errors.New("a list of keys requires -bucket, or use a .csv manifest of bucket,key rows")
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The lines of the files written on Windows end in \r. The keys can
+		// start or end with spaces, which are kept.
+		if key := strings.TrimSuffix(scanner.Text(), "\r"); key != "" {
+			keys = append(keys, listedKey{bucket: bucketName, key: key})
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// printListedKeys prints the URI and version of each key.
+func printListedKeys(w io.Writer, keys []listedKey) {
+	for _, k := range keys {
+		if k.versionID != "" {
+			fmt.Fprintf(w, "s3://%s/%s (version %s)\n", k.bucket, printedKey(k.key), k.versionID)
+		} else {
+			fmt.Fprintf(w, "s3://%s/%s\n", k.bucket, printedKey(k.key))
+		}
+	}
+}
+
+// deleteListedKeys deletes keys with DeleteObjects requests of up to
+// deleteBatchSize keys of a bucket, running up to -concurrency requests at
+// once. The keys failing to delete are logged, and their count is returned.
+func deleteListedKeys(ctx context.Context, cfg aws.Config, keys []listedKey) (int64, error) {
+	var batches [][]listedKey
+	clients := map[string]*s3.Client{}
+	byBucket := map[string][]listedKey{}
+	var buckets []string
+	for _, k := range keys {
+		if _, ok := byBucket[k.bucket]; !ok {
+			buckets = append(buckets, k.bucket)
+		}
+		byBucket[k.bucket] = append(byBucket[k.bucket], k)
+	}
+	for _, bucket := range buckets {
+		client, err := newBucketClient(ctx, cfg, bucket)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", bucket, err)
+		}
+		clients[bucket] = client
+		for chunk := range slices.Chunk(byBucket[bucket], deleteBatchSize) {
+			batches = append(batches, chunk)
+		}
+	}
+
+	var failed atomic.Int64
+	err := forEach(len(batches), func(i int) error {
+		batch := batches[i]
+		bucket := batch[0].bucket
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for j, k := range batch {
+			objects[j] = types.ObjectIdentifier{Key: aws.String(k.key)}
+			if k.versionID != "" {
+				objects[j].VersionId = aws.String(k.versionID)
+			}
+		}
+		response, err := clients[bucket].DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			// The report records the whole batch as failed.
+			for _, k := range batch {
+				reportDeletion(k, err)
+			}
+			return fmt.Errorf("%s: %w", bucket, err)
+		}
+		errs := map[listedKey]error{}
+		for _, e := range response.Errors {
+			k := listedKey{bucket: bucket, key: aws.ToString(e.Key), versionID: aws.ToString(e.VersionId)}
+			errs[k] = fmt.Errorf("%s: %s", aws.ToString(e.Code), aws.ToString(e.Message))
+			log.Printf("error: failed to delete s3://%s/%s: %v", bucket, printedKey(k.key), errs[k])
+			failed.Add(1)
+		}
+		for _, k := range batch {
+			reportDeletion(k, errs[k])
+		}
+		return nil
+	})
+	return failed.Load(), err
+}
+
+// reportDeletion adds k to the -delete-report, as failed with err if not nil.
+func reportDeletion(k listedKey, err error) {
+	obj := object{bucket: k.bucket, versionID: k.versionID}
+	obj.Key = aws.String(k.key)
+	deletions.add(&obj, err)
+}
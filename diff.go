@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// The changes reported by -since-file and -since-inventory-diff, by
+// -find-orphans, and by -other-bucket.
+const (
+	changeAdded        = "added"
+	changeRemoved      = "removed"
+	changeChanged      = "changed"
+	changeOrphan       = "orphan"
+	changeMissing      = "missing"
+	changeOnlyInBucket = "only-in-bucket"
+	changeOnlyInOther  = "only-in-other"
+	changeDiffers      = "differs"
+)
+
+// changeMarkers prefix the changed objects in the text output.
+var changeMarkers = map[string]rune{
+	changeAdded:        '+',
+	changeRemoved:      '-',
+	changeChanged:      '~',
+	changeOrphan:       '+',
+	changeMissing:      '-',
+	changeOnlyInBucket: '<',
+	changeOnlyInOther:  '>',
+	changeDiffers:      '~',
+}
+
+// snapshotKey returns the key of obj in a snapshot.
+func snapshotKey(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// readSnapshot reads a previous listing written with -output ndjson.
+func readSnapshot(r io.Reader) (map[string]ObjectRecord, error) {
+	records := map[string]ObjectRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record ObjectRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid snapshot line: %w", err)
+		}
+		records[snapshotKey(record.Bucket, record.Key)] = record
+	}
+	return records, scanner.Err()
+}
+
+// recordObject converts a snapshot record back into an object.
+func recordObject(r ObjectRecord) object {
+	obj := object{bucket: r.Bucket}
+	obj.Key = &r.Key
+	obj.Size = &r.Size
+	obj.LastModified = &r.LastModified
+	obj.StorageClass = types.ObjectStorageClass(r.StorageClass)
+	if r.ETag != "" {
+		obj.ETag = aws.String(`"` + r.ETag + `"`)
+	}
+	return obj
+}
+
+// diffObjects returns the objects of current added or changed since previous
+// and the objects of previous removed since, sorted by bucket and key. An
+// object changed if its size or ETag differ, or its modification time when
+// either has no ETag.
+func diffObjects(previous map[string]ObjectRecord, current []object) []object {
+	var changes []object
+	seen := make(map[string]bool, len(current))
+	for _, obj := range current {
+		k := snapshotKey(obj.bucket, *obj.Key)
+		seen[k] = true
+		before, ok := previous[k]
+		if !ok {
+			obj.change = changeAdded
+			changes = append(changes, obj)
+			continue
+		}
+		after := newObjectRecord(obj)
+		modified := after.Size != before.Size
+		if after.ETag != "" && before.ETag != "" {
+			modified = modified || after.ETag != before.ETag
+		} else {
+			modified = modified || !after.LastModified.Equal(before.LastModified)
+		}
+		if modified {
+			obj.change = changeChanged
+			changes = append(changes, obj)
+		}
+	}
+	for k, record := range previous {
+		if !seen[k] {
+			obj := recordObject(record)
+			obj.change = changeRemoved
+			changes = append(changes, obj)
+		}
+	}
+	slices.SortFunc(changes, objectOrders["key"])
+	return changes
+}
+
+// diffWriter buffers the listed objects and, when closed, writes to w only
+// the objects changed since a previous snapshot. With -since-inventory-diff,
+// the listing is then stored with storeSnapshot for the next run.
+type diffWriter struct {
+	w        objectWriter
+	previous map[string]ObjectRecord
+	objs     []object
+
+	// upload is where the snapshot of this run is stored, if any.
+	upload func() (io.WriteCloser, error)
+}
+
+// newDiffWriter loads the previous snapshot from -since-file, or from the
+// latest snapshot below the -since-inventory-diff URI.
+func newDiffWriter(ctx context.Context, cfg aws.Config, w objectWriter) (*diffWriter, error) {
+	d := &diffWriter{w: w, previous: map[string]ObjectRecord{}}
+	if sinceFile != "" {
+		f, err := os.Open(sinceFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if d.previous, err = readSnapshot(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", sinceFile, err)
+		}
+		return d, nil
+	}
+
+	bucket, prefix, err := parseS3URI(sinceInventory)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newBucketClient(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := latestSnapshot(ctx, client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if latest == "" {
+		if !quiet {
+			log.Printf("note: no previous snapshot in %s, every object is reported as added", sinceInventory)
+		}
+	} else {
+		response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &latest})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the previous snapshot: %w", err)
+		}
+		defer response.Body.Close()
+		if d.previous, err = readSnapshot(response.Body); err != nil {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, latest, err)
+		}
+	}
+	d.upload = func() (io.WriteCloser, error) {
+		key := prefix + startTime.UTC().Format("20060102T150405.000Z") + ".ndjson"
+		return newS3Upload(ctx, cfg, fmt.Sprintf("s3://%s/%s", bucket, key), contentTypes["ndjson"])
+	}
+	return d, nil
+}
+
+// latestSnapshot returns the key of the most recent snapshot below prefix,
+// or "" when there is none. The snapshot keys are timestamps, so the latest
+// sorts last.
+func latestSnapshot(ctx context.Context, client *s3.Client, bucket, prefix string) (string, error) {
+	var latest string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return "", err
+		}
+		for _, obj := range page.Contents {
+			if strings.HasSuffix(*obj.Key, ".ndjson") && *obj.Key > latest {
+				latest = *obj.Key
+			}
+		}
+	}
+	return latest, nil
+}
+
+func (d *diffWriter) Write(obj object) error {
+	d.objs = append(d.objs, obj)
+	return nil
+}
+
+// WritePrefix drops the common prefixes, the snapshots only hold objects.
+func (d *diffWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (d *diffWriter) Close() error {
+	for _, obj := range diffObjects(d.previous, d.objs) {
+		if err := d.w.Write(obj); err != nil {
+			return err
+		}
+	}
+	return d.w.Close()
+}
+
+// storeSnapshot stores the listing as the snapshot of the next
+// -since-inventory-diff run. It must only be called once the listing is
+// complete, or the next run would report the missing objects as removed.
+func (d *diffWriter) storeSnapshot() error {
+	if d.upload == nil {
+		return nil
+	}
+	u, err := d.upload()
+	if err != nil {
+		return err
+	}
+	snapshot := newJSONWriter(&output{w: u, buf: bufio.NewWriterSize(u, outputBufferSize)}, true)
+	for _, obj := range d.objs {
+		if err := snapshot.Write(obj); err != nil {
+			return err
+		}
+	}
+	if err := snapshot.Close(); err != nil {
+		return fmt.Errorf("failed to store the snapshot: %w", err)
+	}
+	return nil
+}
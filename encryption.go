@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// encryptionStatus is the server-side encryption of an object.
+type encryptionStatus struct {
+	algorithm types.ServerSideEncryption
+	kmsKeyID  string
+}
+
+func (e encryptionStatus) String() string {
+	var name string
+	switch e.algorithm {
+	case "":
+		return "encryption: none"
+	case types.ServerSideEncryptionAes256:
+		name = "SSE-S3"
+	case types.ServerSideEncryptionAwsKms:
+		name = "SSE-KMS"
+	case types.ServerSideEncryptionAwsKmsDsse:
+		name = "DSSE-KMS"
+	default:
+		name = string(e.algorithm)
+	}
+	if e.kmsKeyID != "" {
+		return fmt.Sprintf("encryption: %s %s", name, e.kmsKeyID)
+	}
+	return "encryption: " + name
+}
+
+// fetchEncryption is the enricher fetching the server-side encryption of obj
+// with a HeadObject request.
+func fetchEncryption(ctx context.Context, client *s3.Client, obj *object) error {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &obj.bucket,
+		Key:    obj.Key,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get the encryption of %s: %w", *obj.Key, err)
+	}
+	obj.encryption = &encryptionStatus{
+		algorithm: head.ServerSideEncryption,
+		kmsKeyID:  aws.ToString(head.SSEKMSKeyId),
+	}
+	return nil
+}
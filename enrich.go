@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// enricher fetches or changes something about obj with per-object requests.
+type enricher func(ctx context.Context, client *s3.Client, obj *object) error
+
+// enrichers returns the enrichers requested on the command line.
+func enrichers() []enricher {
+	var e []enricher
+	// The filter goes first, so that the objects it excludes are neither
+	// fetched nor modified.
+	if contentTypePrefix != "" {
+		e = append(e, matchContentType)
+	}
+	if showLocks {
+		e = append(e, fetchLock)
+	}
+	if showEncryption {
+		e = append(e, fetchEncryption)
+	}
+	if catContent {
+		e = append(e, fetchContent)
+	}
+	if rewritesMetadata() && !dryRun {
+		e = append(e, updateMetadata)
+	}
+	if deletesVersions() && !dryRun {
+		e = append(e, deleteVersion)
+	}
+	return e
+}
+
+// enrichObjects runs the enrichers on objs, up to -concurrency objects at
+// once, and calls emit with each object once enriched, unless excluded. The
+// objects are emitted in order as soon as all the previous ones are, or as
+// soon as they are ready with -unordered. emit is never called concurrently.
+func enrichObjects(ctx context.Context, client *s3.Client, objs []object, emit func(obj object) error) error {
+	fetchers := enrichers()
+	if len(fetchers) == 0 {
+		for _, obj := range objs {
+			if err := emit(obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// enrich returns the error stopping the enrichment, else the last error
+	// skipped, which forEach passes to the limiter only.
+	enrich := func(obj *object) error {
+		var skipped error
+		for _, fetch := range fetchers {
+			err := fetch(ctx, client, obj)
+			if isSkipped(err) {
+				skipped = err
+			} else if err != nil {
+				return err
+			}
+			if obj.excluded {
+				break
+			}
+		}
+		return skipped
+	}
+
+	if unordered {
+		var mu sync.Mutex
+		return forEach(len(objs), func(i int) error {
+			err := enrich(&objs[i])
+			if objs[i].excluded || err != nil && !isSkipped(err) {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if emitErr := emit(objs[i]); emitErr != nil {
+				return emitErr
+			}
+			return err
+		})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make([]chan error, len(objs))
+	for i := range done {
+		done[i] = make(chan error, 1)
+	}
+	// The errors are returned for the limiter to see the throttling, the
+	// first one stopping the enrichment being returned below.
+	go forEach(len(objs), func(i int) error {
+		err := enrich(&objs[i])
+		if isSkipped(err) {
+			done[i] <- nil
+		} else {
+			done[i] <- err
+		}
+		return err
+	})
+	for i := range objs {
+		if err := <-done[i]; err != nil {
+			return err
+		}
+		if objs[i].excluded {
+			continue
+		}
+		if err := emit(objs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skippedContentTypes counts the objects -content-type excluded because
+// their HeadObject request failed.
+var skippedContentTypes atomic.Int64
+
+// matchContentType is the enricher excluding the objects whose Content-Type,
+// fetched with a HeadObject request, does not start with -content-type. The
+// objects failing the request are logged and excluded, and their errors
+// skipped rather than stopping the listing.
+func matchContentType(ctx context.Context, client *s3.Client, obj *object) error {
+	input := &s3.HeadObjectInput{Bucket: &obj.bucket, Key: obj.Key}
+	if obj.versionID != "" {
+		input.VersionId = &obj.versionID
+	}
+	head, err := client.HeadObject(ctx, input)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("warning: skipping s3://%s/%s, failed to get its content type: %v", obj.bucket, printedKey(*obj.Key), err)
+		skippedContentTypes.Add(1)
+		obj.excluded = true
+		return skippedError{err}
+	}
+	obj.contentType = aws.ToString(head.ContentType)
+	obj.excluded = !strings.HasPrefix(obj.contentType, contentTypePrefix)
+	return nil
+}
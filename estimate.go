@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// The approximate us-east-1 request prices, per 1,000 requests, of the
+// requests -estimate-requests counts. DELETE requests are free.
+const (
+	listRequestPrice = 0.005
+	getRequestPrice  = 0.0004
+	copyRequestPrice = 0.005
+)
+
+// listPageSize is the number of keys of a full ListObjectsV2 or
+// ListObjectVersions page.
+const listPageSize = 1000
+
+// requestEstimate is the number of objects a run would list and match, as
+// counted from the first page of each listing.
+type requestEstimate struct {
+	listed, matched int64
+	// exact is false when a first page was truncated, the counts then being
+	// extrapolated from -estimated-objects or else a lower bound.
+	exact bool
+}
+
+// estimateObjects lists the first page of each prefix of buckets and counts
+// the keys listed and matched. When a page is truncated, the matched share of
+// the first pages is applied to -estimated-objects when set.
+func estimateObjects(ctx context.Context, cfg aws.Config, buckets, prefixes []string) (requestEstimate, error) {
+	e := requestEstimate{exact: true}
+	for _, bucket := range buckets {
+		client, err := newBucketClient(ctx, cfg, bucket)
+		if err != nil {
+			return e, fmt.Errorf("%s: %w", bucket, err)
+		}
+		for _, prefix := range prefixes {
+			objs, truncated, err := firstPage(ctx, client, bucket, prefix)
+			if err != nil {
+				return e, fmt.Errorf("%s: %w", bucket, err)
+			}
+			e.listed += int64(len(objs))
+			for _, obj := range objs {
+				if matchObject(bucket, obj.Object) {
+					e.matched++
+				}
+			}
+			e.exact = e.exact && !truncated
+		}
+	}
+	if !e.exact && estimatedObjects > 0 && e.listed > 0 {
+		e.matched = int64(math.Round(float64(e.matched) / float64(e.listed) * float64(estimatedObjects)))
+		e.listed = estimatedObjects
+	}
+	return e, nil
+}
+
+// objectRequests returns the GET-class and COPY requests made per matched
+// object by the requested enrichers.
+func objectRequests() (gets, copies int64) {
+	if contentTypePrefix != "" {
+		gets++
+	}
+	if showLocks {
+		// The retention and the legal hold.
+		gets += 2
+	}
+	if showEncryption {
+		gets++
+	}
+	if catContent {
+		gets++
+	}
+	if rewritesMetadata() {
+		// The HeadObject carrying the headers over, then the copy.
+		gets++
+		copies++
+	}
+	return gets, copies
+}
+
+// printRequestEstimate prints the requests and their cost estimated from e,
+// for the listings of target.
+func printRequestEstimate(w io.Writer, target string, e requestEstimate) {
+	approx := "~"
+	switch {
+	case e.exact:
+		approx = ""
+	case estimatedObjects <= 0:
+		approx = "at least "
+	}
+	lists := max(1, (e.listed+listPageSize-1)/listPageSize)
+	fmt.Fprintf(w, "Estimated requests for %s, from approximate us-east-1 prices:\n", target)
+	fmt.Fprintf(w, "%s%s objects listed with %s%s LIST requests, ~$%.4f\n",
+		approx, formatCount(e.listed), approx, formatCount(lists), float64(lists)/1000*listRequestPrice)
+	total := float64(lists) / 1000 * listRequestPrice
+
+	gets, copies := objectRequests()
+	if gets > 0 || copies > 0 || deletesVersions() {
+		fmt.Fprintf(w, "%s%s objects matched\n", approx, formatCount(e.matched))
+	}
+	if gets > 0 {
+		cost := float64(gets*e.matched) / 1000 * getRequestPrice
+		fmt.Fprintf(w, "%s%s GET and HEAD requests, ~$%.4f\n", approx, formatCount(gets*e.matched), cost)
+		total += cost
+	}
+	if copies > 0 {
+		cost := float64(copies*e.matched) / 1000 * copyRequestPrice
+		fmt.Fprintf(w, "%s%s COPY requests, ~$%.4f\n", approx, formatCount(copies*e.matched), cost)
+		total += cost
+	}
+	if deletesVersions() {
+		fmt.Fprintf(w, "%s%s DELETE requests, free\n", approx, formatCount(e.matched))
+	}
+	fmt.Fprintf(w, "Total: %s$%.4f\n", approx, total)
+	if !e.exact && estimatedObjects <= 0 {
+		fmt.Fprintln(w, "The listing has more than one page, pass -estimated-objects with the approximate object count for an estimate")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// exprEnv holds the variables of an -expr expression for an object. The age
+// is in seconds, like the durations written in the expression.
+type exprEnv struct {
+	Bucket   string    `expr:"bucket"`
+	URI      string    `expr:"uri"`
+	Key      string    `expr:"key"`
+	Size     int64     `expr:"size"`
+	Age      float64   `expr:"age"`
+	Modified time.Time `expr:"modified"`
+	Class    string    `expr:"class"`
+	ETag     string    `expr:"etag"`
+	Ext      string    `expr:"ext"`
+}
+
+// exprTokens matches the parts of an expression rewritten by compileExpr:
+// the sizes and durations such as 100MB or 30d, and the ~ operator. The
+// string literals are matched so that they are left untouched.
+var exprTokens = regexp.MustCompile("\"(?:\\\\.|[^\"\\\\])*\"|'(?:\\\\.|[^'\\\\])*'|`[^`]*`|" +
+	`\b(\d+(?:\.\d+)?)([KMGTP]B|B|ms|s|m|h|d|w)\b|~`)
+
+// exprSizeUnits are the units of the size literals, in powers of 1024 like
+// the size flags.
+var exprSizeUnits = map[string]float64{"B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40, "PB": 1 << 50}
+
+// compileExpr compiles the -expr expression src. It extends the expr-lang
+// syntax with size literals, converted to bytes, duration literals,
+// converted to seconds, and a ~ operator matching a regular expression. A
+// double-quoted regular expression after ~ is taken as a raw string, so that
+// "\.log$" needs no double backslash.
+func compileExpr(src string) (*vm.Program, error) {
+	var literalErr error
+	afterMatch := false
+	src = exprTokens.ReplaceAllStringFunc(src, func(token string) string {
+		wasAfterMatch := afterMatch
+		afterMatch = token == "~"
+		switch {
+		case token == "~":
+			return " matches "
+		case token[0] == '"' && wasAfterMatch && !strings.Contains(token, "`"):
+			return "`" + strings.ReplaceAll(token[1:len(token)-1], `\"`, `"`) + "`"
+		case token[0] == '"' || token[0] == '\'' || token[0] == '`':
+			return token
+		}
+		m := exprTokens.FindStringSubmatch(token)
+		if unit, ok := exprSizeUnits[m[2]]; ok {
+			n, _ := strconv.ParseFloat(m[1], 64)
+			return strconv.FormatInt(int64(n*unit), 10)
+		}
+		d, err := parseAge(token)
+		if err != nil && literalErr == nil {
+			literalErr = fmt.Errorf("invalid duration %q", token)
+		}
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	})
+	if literalErr != nil {
+		return nil, literalErr
+	}
+	return expr.Compile(src, expr.Env(exprEnv{}), expr.AsBool())
+}
+
+// matchExpr reports whether obj of bucket matches the compiled -expr program.
+func matchExpr(program *vm.Program, bucket string, obj types.Object) (bool, error) {
+	matched, err := expr.Run(program, exprEnv{
+		Bucket:   bucket,
+		URI:      "s3://" + bucket + "/" + aws.ToString(obj.Key),
+		Key:      aws.ToString(obj.Key),
+		Size:     aws.ToInt64(obj.Size),
+		Age:      startTime.Sub(aws.ToTime(obj.LastModified)).Seconds(),
+		Modified: aws.ToTime(obj.LastModified),
+		Class:    string(obj.StorageClass),
+		ETag:     aws.ToString(obj.ETag),
+		Ext:      path.Ext(aws.ToString(obj.Key)),
+	})
+	if err != nil {
+		return false, err
+	}
+	return matched.(bool), nil
+}
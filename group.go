@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// groupKeys maps the -group-by values to the function extracting the group
+// of an object.
+var groupKeys = map[string]func(obj types.Object) string{
+	"storage-class": func(obj types.Object) string {
+		return string(obj.StorageClass)
+	},
+	"extension": func(obj types.Object) string {
+		return path.Ext(*obj.Key)
+	},
+	"top-prefix": func(obj types.Object) string {
+		key := strings.TrimPrefix(*obj.Key, bucketPrefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			return bucketPrefix + key[:i+1]
+		}
+		return ""
+	},
+	// The collapsed keys group the date and partition variants of a logical
+	// key, such as the part files of daily logs.
+	"collapsed": func(obj types.Object) string {
+		return collapse.ReplaceAllLiteralString(*obj.Key, "*")
+	},
+}
+
+// groupWriter aggregates the objects into groups and prints a table of the
+// groups sorted by size when closed.
+type groupWriter struct {
+	w       io.WriteCloser
+	by      string
+	keyFunc func(obj types.Object) string
+	groups  map[string]*usage
+	total   usage
+
+	// asJSON prints the groups as a GroupsRecord instead of a table.
+	asJSON bool
+}
+
+func newGroupWriter(w io.WriteCloser, by string, asJSON bool) (*groupWriter, error) {
+	keyFunc, ok := groupKeys[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown -group-by %q, expected storage-class, extension, top-prefix or collapsed", by)
+	}
+	return &groupWriter{w: w, by: by, keyFunc: keyFunc, groups: map[string]*usage{}, asJSON: asJSON}, nil
+}
+
+func (g *groupWriter) Write(obj object) error {
+	key := g.keyFunc(obj.Object)
+	u, ok := g.groups[key]
+	if !ok {
+		u = &usage{}
+		g.groups[key] = u
+	}
+	o := usage{count: 1, size: *obj.Size}
+	u.add(o)
+	g.total.add(o)
+	return nil
+}
+
+func (g *groupWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (g *groupWriter) Close() error {
+	names := make([]string, 0, len(g.groups))
+	width := len("TOTAL")
+	for name := range g.groups {
+		names = append(names, name)
+		width = max(width, len(groupLabel(name)))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return g.groups[names[i]].size > g.groups[names[j]].size
+	})
+	if g.asJSON {
+		return g.writeJSON(names)
+	}
+
+	fmt.Fprintf(g.w, "%-*s %10s %9s %7s\n", width, "GROUP", "COUNT", "SIZE", "%")
+	for _, name := range names {
+		g.printRow(width, groupLabel(name), *g.groups[name])
+	}
+	g.printRow(width, "TOTAL", g.total)
+	return g.w.Close()
+}
+
+func (g *groupWriter) printRow(width int, label string, u usage) {
+	fmt.Fprintf(g.w, "%-*s %10d %9s %6.1f%%\n", width, label, u.count, byteCountIEC(u.size), g.percent(u))
+}
+
+// percent returns the share of the total size held by u.
+func (g *groupWriter) percent(u usage) float64 {
+	if g.total.size == 0 {
+		return 0
+	}
+	return 100 * float64(u.size) / float64(g.total.size)
+}
+
+// writeJSON writes the groups of names, in this order, as a GroupsRecord.
+func (g *groupWriter) writeJSON(names []string) error {
+	record := GroupsRecord{
+		GroupBy: g.by,
+		Groups:  make([]GroupRecord, len(names)),
+		Total:   UsageRecord{Objects: g.total.count, Bytes: g.total.size},
+	}
+	for i, name := range names {
+		u := *g.groups[name]
+		record.Groups[i] = GroupRecord{Group: name, Objects: u.count, Bytes: u.size, Percent: g.percent(u)}
+	}
+	if err := json.NewEncoder(g.w).Encode(record); err != nil {
+		g.w.Close()
+		return err
+	}
+	return g.w.Close()
+}
+
+// depthWriter aggregates the objects by their depth below -prefix and prints
+// a table of the depths in order when closed.
+type depthWriter struct {
+	w      io.WriteCloser
+	depths map[int]*usage
+	total  usage
+}
+
+func (d *depthWriter) Write(obj object) error {
+	depth := depthBelowPrefix(*obj.Key)
+	u, ok := d.depths[depth]
+	if !ok {
+		u = &usage{}
+		d.depths[depth] = u
+	}
+	o := usage{count: 1, size: *obj.Size}
+	u.add(o)
+	d.total.add(o)
+	return nil
+}
+
+func (d *depthWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (d *depthWriter) Close() error {
+	depths := make([]int, 0, len(d.depths))
+	for depth := range d.depths {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+
+	// The rows are printed like the -group-by ones.
+	g := groupWriter{w: d.w, total: d.total}
+	width := len("TOTAL")
+	fmt.Fprintf(d.w, "%-*s %10s %9s %7s\n", width, "DEPTH", "COUNT", "SIZE", "%")
+	for _, depth := range depths {
+		g.printRow(width, strconv.Itoa(depth), *d.depths[depth])
+	}
+	g.printRow(width, "TOTAL", d.total)
+	return d.w.Close()
+}
+
+func groupLabel(name string) string {
+	if name == "" {
+		return "(none)"
+	}
+	return name
+}
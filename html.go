@@ -0,0 +1,56 @@
+package main
+
+import "html/template"
+
+// htmlReport is the template of -output html: a self-contained page with a
+// summary header and a table of the objects sorted by clicking the column
+// headers. The sizes and dates are sorted by their data-sort values.
+var htmlReport = template.Must(template.New("html").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Target}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+th { cursor: pointer; background: #f4f4f4; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+td.size { text-align: right; white-space: nowrap; }
+td.key { font-family: monospace; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>{{.Target}}</h1>
+<p>{{.Count}} objects, {{size .Size}}, listed on {{date .Generated}}.</p>
+<table>
+<thead><tr><th>Size</th><th>Modified</th><th>Class</th><th>Key</th></tr></thead>
+<tbody>
+{{- range .Objects}}
+<tr><td class="size" data-sort="{{.Size}}">{{size .Size}}</td><td data-sort="{{.LastModified.Unix}}">{{date .LastModified}}</td><td>{{.StorageClass}}</td><td class="key">{{uri .}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("th").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var tbody = document.querySelector("tbody");
+    var asc = !th.classList.contains("asc");
+    document.querySelectorAll("th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+    th.classList.add(asc ? "asc" : "desc");
+    var value = function (row) {
+      var cell = row.cells[column];
+      return cell.dataset.sort !== undefined ? Number(cell.dataset.sort) : cell.textContent;
+    };
+    Array.from(tbody.rows).sort(function (a, b) {
+      var x = value(a), y = value(b);
+      var order = x < y ? -1 : x > y ? 1 : 0;
+      return asc ? order : -order;
+    }).forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
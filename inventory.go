@@ -0,0 +1,240 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// inventoryBatchSize is the number of inventory rows filtered and written at
+// once, like a page of ListObjectsV2.
+const inventoryBatchSize = 1000
+
+// inventoryManifest is the manifest.json of an S3 Inventory report.
+type inventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// parseS3URI splits an s3://bucket/key URI.
+func parseS3URI(uri string) (string, string, error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	bucket, key, _ := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("expected s3://bucket/key, got %q", uri)
+	}
+	return bucket, key, nil
+}
+
+// readInventoryManifest fetches and decodes the inventory manifest at uri.
+// Only the CSV format is supported.
+func readInventoryManifest(ctx context.Context, cfg aws.Config, uri string) (*inventoryManifest, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newBucketClient(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the inventory manifest: %w", err)
+	}
+	defer response.Body.Close()
+
+	var manifest inventoryManifest
+	if err := json.NewDecoder(response.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid inventory manifest: %w", err)
+	}
+	if manifest.FileFormat != "CSV" {
+		return nil, fmt.Errorf("unsupported inventory format %q, only CSV is supported", manifest.FileFormat)
+	}
+	if manifest.DestinationBucket == "" {
+		manifest.DestinationBucket = bucket
+	}
+	manifest.DestinationBucket = strings.TrimPrefix(manifest.DestinationBucket, "arn:aws:s3:::")
+	return &manifest, nil
+}
+
+// listInventory lists the objects of the inventory data files of manifest
+// instead of the source bucket, writing the matched ones to out and adding
+// them to total.
+func listInventory(ctx context.Context, cfg aws.Config, manifest *inventoryManifest, out objectWriter, total *stats) error {
+	// The source bucket is only queried by the enrichers.
+	var sourceClient *s3.Client
+	if len(enrichers()) > 0 {
+		var err error
+		sourceClient, err = newBucketClient(ctx, cfg, manifest.SourceBucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	var batch []types.Object
+	flush := func() error {
+		budgetExhausted, err := processObjects(ctx, sourceClient, bucketObjects(manifest.SourceBucket, batch), out, total)
+		batch = batch[:0]
+		if err == nil && budgetExhausted {
+			return errBudgetExhausted
+		}
+		return err
+	}
+	err := readInventory(ctx, cfg, manifest, func(obj types.Object) error {
+		batch = append(batch, obj)
+		if len(batch) < inventoryBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	if errors.Is(err, errBudgetExhausted) {
+		return nil
+	}
+	return err
+}
+
+// errBudgetExhausted stops reading an inventory once the -max-keys budget is
+// exhausted.
+var errBudgetExhausted = errors.New("-max-keys budget exhausted")
+
+// readInventory calls fn with each object of the inventory data files of
+// manifest, until fn returns an error.
+func readInventory(ctx context.Context, cfg aws.Config, manifest *inventoryManifest, fn func(obj types.Object) error) error {
+	columns := map[string]int{}
+	for i, name := range strings.Split(manifest.FileSchema, ",") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"Key", "Size", "LastModifiedDate"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("the inventory lacks the %s field", name)
+		}
+	}
+
+	client, err := newBucketClient(ctx, cfg, manifest.DestinationBucket)
+	if err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		if err := readInventoryFile(ctx, client, manifest.DestinationBucket, file.Key, columns, fn); err != nil {
+			if errors.Is(err, errBudgetExhausted) {
+				return err
+			}
+			return fmt.Errorf("%s: %w", file.Key, err)
+		}
+	}
+	return nil
+}
+
+// readInventoryFile calls fn with each object of the CSV inventory file at key
+// in bucket. The files written by S3 Inventory are gzipped, which is told by
+// their .gz extension or their content type, but uncompressed files are read
+// too.
+func readInventoryFile(ctx context.Context, client *s3.Client, bucket, key string, columns map[string]int, fn func(obj types.Object) error) error {
+	response, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body := throttle(response.Body)
+	if isGzipped(key, aws.ToString(response.ContentType)) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = len(columns)
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		obj, ok, err := inventoryObject(record, columns)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isGzipped reports whether the inventory file at key, of contentType, is
+// compressed with gzip.
+func isGzipped(key, contentType string) bool {
+	switch contentType {
+	case "application/gzip", "application/x-gzip":
+		return true
+	}
+	return strings.HasSuffix(key, ".gz")
+}
+
+// inventoryObject converts an inventory record into an object. It reports
+// false for the records outside -prefix, and for the delete markers and
+// noncurrent versions of versioned inventories.
+func inventoryObject(record []string, columns map[string]int) (types.Object, bool, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	if field("IsDeleteMarker") == "true" || field("IsLatest") == "false" {
+		return types.Object{}, false, nil
+	}
+
+	// The keys are URL-encoded.
+	key, err := url.QueryUnescape(field("Key"))
+	if err != nil {
+		return types.Object{}, false, fmt.Errorf("invalid key %q: %w", field("Key"), err)
+	}
+	if !strings.HasPrefix(key, bucketPrefix) {
+		return types.Object{}, false, nil
+	}
+	size, err := strconv.ParseInt(field("Size"), 10, 64)
+	if err != nil {
+		return types.Object{}, false, fmt.Errorf("invalid size of %s: %w", key, err)
+	}
+	lastModified, err := time.Parse(time.RFC3339Nano, field("LastModifiedDate"))
+	if err != nil {
+		return types.Object{}, false, fmt.Errorf("invalid last modified date of %s: %w", key, err)
+	}
+	obj := types.Object{
+		Key:          &key,
+		Size:         &size,
+		LastModified: &lastModified,
+		StorageClass: types.ObjectStorageClass(field("StorageClass")),
+	}
+	if etag := field("ETag"); etag != "" {
+		obj.ETag = &etag
+	}
+	return obj, true, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// latestWriter keeps only the most recently modified object of each group
+// and writes them to w, sorted by group, when closed. The group of an object
+// is its key up to the last "/", or the first capture group of re (or its
+// whole match) when set, in which case the keys re does not match are
+// dropped.
+type latestWriter struct {
+	w      objectWriter
+	re     *regexp.Regexp
+	latest map[string]object
+}
+
+func newLatestWriter(w objectWriter, re *regexp.Regexp) *latestWriter {
+	return &latestWriter{w: w, re: re, latest: map[string]object{}}
+}
+
+// group returns the group of key, and false when re does not match it.
+func (l *latestWriter) group(bucket, key string) (string, bool) {
+	if l.re == nil {
+		return bucket + "/" + path.Dir(key), true
+	}
+	m := l.re.FindStringSubmatch(key)
+	if m == nil {
+		return "", false
+	}
+	if len(m) > 1 {
+		return bucket + "/" + m[1], true
+	}
+	return bucket + "/" + m[0], true
+}
+
+func (l *latestWriter) Write(obj object) error {
+	group, ok := l.group(obj.bucket, *obj.Key)
+	if !ok {
+		return nil
+	}
+	if best, ok := l.latest[group]; !ok || obj.LastModified.After(*best.LastModified) {
+		l.latest[group] = obj
+	}
+	return nil
+}
+
+func (l *latestWriter) WritePrefix(bucket, prefix string) error {
+	return l.w.WritePrefix(bucket, prefix)
+}
+
+func (l *latestWriter) Close() error {
+	groups := make([]string, 0, len(l.latest))
+	for group := range l.latest {
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, strings.Compare)
+	for _, group := range groups {
+		if err := l.w.Write(l.latest[group]); err != nil {
+			return err
+		}
+	}
+	return l.w.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// storagePrices are the approximate us-east-1 storage prices per GB-month
+// of the classes a lifecycle rule can transition to, and of STANDARD.
+var storagePrices = map[types.StorageClass]float64{
+	types.StorageClassStandard:           0.023,
+	types.StorageClassStandardIa:         0.0125,
+	types.StorageClassOnezoneIa:          0.01,
+	types.StorageClassIntelligentTiering: 0.023,
+	types.StorageClassGlacierIr:          0.004,
+	types.StorageClassGlacier:            0.0036,
+	types.StorageClassDeepArchive:        0.00099,
+}
+
+// lateForTransition reports whether obj is older than
+// -expect-transition-after and still in STANDARD. matchObject only keeps
+// those objects, so that every total counts the late objects alone.
+func lateForTransition(obj types.Object) bool {
+	// The listings leave the storage class of STANDARD objects empty.
+	if obj.StorageClass != "" && obj.StorageClass != types.ObjectStorageClassStandard {
+		return false
+	}
+	return startTime.Sub(*obj.LastModified) > expectTransition
+}
+
+// lifecycleWriter audits a lifecycle transition for -expect-transition-after:
+// it tallies the objects passed on to w, which matchObject narrowed to the
+// late ones, and when closed reports to summary how much they cost per
+// month more than in the -expect-transition-to class.
+type lifecycleWriter struct {
+	w       objectWriter
+	summary io.Writer
+	class   types.StorageClass
+	late    usage
+}
+
+func newLifecycleWriter(w objectWriter, summary io.Writer, class types.StorageClass) *lifecycleWriter {
+	return &lifecycleWriter{w: w, summary: summary, class: class}
+}
+
+func (l *lifecycleWriter) Write(obj object) error {
+	l.late.add(usage{count: 1, size: *obj.Size})
+	return l.w.Write(obj)
+}
+
+// WritePrefix drops the common prefixes, they have no storage class.
+func (l *lifecycleWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (l *lifecycleWriter) Close() error {
+	if err := l.w.Close(); err != nil {
+		return err
+	}
+	if l.late.count == 0 {
+		fmt.Fprintf(l.summary, "every object older than %s is out of STANDARD\n", expectTransitionStr)
+		return nil
+	}
+	gb := float64(l.late.size) / (1 << 30)
+	wasted := gb * (storagePrices[types.StorageClassStandard] - storagePrices[l.class])
+	fmt.Fprintf(l.summary, "%d objects (%s) older than %s are still in STANDARD, ~$%.2f per month more than in %s at approximate us-east-1 prices\n",
+		l.late.count, byteCountIEC(l.late.size), expectTransitionStr, wasted, l.class)
+	return nil
+}
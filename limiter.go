@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// With -concurrency auto, the number of requests in flight starts at
+// autoConcurrencyStart and adapts between 1 and autoConcurrencyMax with an
+// additive increase, multiplicative decrease controller:
+//
+//   - after as many fast requests as the current limit, the limit grows by 1;
+//   - a request answered more than twice as slowly as the fastest one seen
+//     holds the limit, as S3 slowing down precedes throttling;
+//   - a request failing with a throttling error halves the limit.
+//
+// The limit learned is kept across calls, so each page starts where the
+// previous one ended.
+const (
+	autoConcurrencyStart = 4
+	autoConcurrencyMax   = 64
+)
+
+// autoConcurrency is set by -concurrency auto.
+var autoConcurrency bool
+
+// learnedConcurrency is the limit reached by the last automatic limiter.
+var learnedConcurrency atomic.Int64
+
+// concurrencyFlag parses -concurrency, a number or auto.
+func concurrencyFlag(s string) error {
+	if s == "auto" {
+		autoConcurrency = true
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("expected a number or auto")
+	}
+	autoConcurrency = false
+	concurrency = n
+	return nil
+}
+
+// limiter bounds the number of calls in flight.
+type limiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	inFlight  int
+	limit     int
+	fastest   time.Duration
+	successes int
+}
+
+func newLimiter() *limiter {
+	l := &limiter{limit: concurrency}
+	if autoConcurrency {
+		l.limit = int(learnedConcurrency.Load())
+		if l.limit == 0 {
+			l.limit = autoConcurrencyStart
+		}
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until a call can start.
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+}
+
+// release ends a call that took elapsed and returned err, adapting the limit
+// with -concurrency auto.
+func (l *limiter) release(elapsed time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	defer l.cond.Broadcast()
+	if !autoConcurrency {
+		return
+	}
+
+	switch {
+	case isThrottling(err):
+		l.limit = max(l.limit/2, 1)
+		l.successes = 0
+	case err != nil:
+	case l.fastest == 0 || elapsed < l.fastest:
+		l.fastest = elapsed
+		fallthrough
+	case elapsed <= 2*l.fastest:
+		l.successes++
+		if l.successes >= l.limit {
+			l.limit = min(l.limit+1, autoConcurrencyMax)
+			l.successes = 0
+		}
+	}
+	learnedConcurrency.Store(int64(l.limit))
+}
+
+// skippedError wraps the error of a per-object request that was logged and
+// skipped rather than stopping the listing. forEach passes it to the limiter,
+// for the throttling to reduce the concurrency, but does not return it.
+type skippedError struct {
+	err error
+}
+
+func (e skippedError) Error() string {
+	return e.err.Error()
+}
+
+func (e skippedError) Unwrap() error {
+	return e.err
+}
+
+// isSkipped reports whether err is a skippedError.
+func isSkipped(err error) bool {
+	var skipped skippedError
+	return errors.As(err, &skipped)
+}
+
+// isThrottling reports whether err is S3 asking to slow down.
+func isThrottling(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+		return true
+	}
+	return false
+}
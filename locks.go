@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// lockStatus is the Object Lock state of an object.
+type lockStatus struct {
+	mode        types.ObjectLockRetentionMode
+	retainUntil *time.Time
+	legalHold   bool
+}
+
+func (l lockStatus) String() string {
+	retention := "none"
+	if l.mode != "" {
+		retention = string(l.mode)
+		if l.retainUntil != nil {
+			retention += " until " + l.retainUntil.Format(time.DateTime)
+		}
+	}
+	legalHold := "off"
+	if l.legalHold {
+		legalHold = "on"
+	}
+	return fmt.Sprintf("retention: %s, legal hold: %s", retention, legalHold)
+}
+
+// fetchLock is the enricher fetching the Object Lock state of obj.
+func fetchLock(ctx context.Context, client *s3.Client, obj *object) error {
+	var err error
+	obj.lock, err = getLockStatus(ctx, client, obj.bucket, *obj.Key)
+	return err
+}
+
+func getLockStatus(ctx context.Context, client *s3.Client, bucket, key string) (*lockStatus, error) {
+	var status lockStatus
+	retention, err := client.GetObjectRetention(ctx, &s3.GetObjectRetentionInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil && !isNoLockConfiguration(err) {
+		return nil, err
+	}
+	if err == nil && retention.Retention != nil {
+		status.mode = retention.Retention.Mode
+		status.retainUntil = retention.Retention.RetainUntilDate
+	}
+
+	legalHold, err := client.GetObjectLegalHold(ctx, &s3.GetObjectLegalHoldInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil && !isNoLockConfiguration(err) {
+		return nil, err
+	}
+	if err == nil && legalHold.LegalHold != nil {
+		status.legalHold = legalHold.LegalHold.Status == types.ObjectLockLegalHoldStatusOn
+	}
+	return &status, nil
+}
+
+// isNoLockConfiguration reports whether err means that the object has no
+// retention or legal hold, or that the bucket has no Object Lock
+// configuration at all.
+func isNoLockConfiguration(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchObjectLockConfiguration", "ObjectLockConfigurationNotFoundError", "InvalidRequest":
+		return true
+	}
+	return false
+}
@@ -1,18 +1,30 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/c2h5oh/datasize"
-	"golang.org/x/term"
+	"github.com/expr-lang/expr/vm"
+	"github.com/jmespath/go-jmespath"
 )
 
 const (
@@ -30,32 +42,642 @@ var (
 	minSize             int64
 	maxSizeStr          string
 	maxSize             int64
+	sizeEqualStr        string
+	sizeEqual           int64 = -1
 	printFullObjectPath bool
+	delimiter           string
+	maxDepth            int
+	outputFormat        string
+	outputPath          string
+	groupBy             string
+	pageTimeout         time.Duration
+	pageRetries         int
+	showLocks           bool
+	concurrency         = 10
+	summaryByPrefix     bool
+	colorMode           string
+	profile             string
+	expectMin           int64
+	expectMax           int64
+	showBand            bool
+	onlyPrefixes        bool
+	prefixFile          string
+	printSummary        bool
+	sizeWidth           int
+	relativeKeys        bool
+	metricsFile         string
+	dedupeByETag        bool
+	bucketsMatching     string
+	relativeTime        bool
+	noStorageClass      bool
+	setContentType      string
+	setMetadata         = metadataFlag{}
+	dryRun              bool
+	assumeYes           bool
+	maxKeys             int64
+	statsJSON           bool
+	expandPrefixGlob    bool
+	manifestPath        string
+	progressEvery       int64
+	pathSegment         string
+	minAgeStr           string
+	minAge              time.Duration
+	maxAgeStr           string
+	maxAge              time.Duration
+	quiet               bool
+	outputBuffered      bool
+	showBucketInfo      bool
+	fromInventory       string
+	unordered           bool
+	compact             bool
+	failOnEmpty         bool
+	sortBy              string
+	limit               int
+	showPercent         bool
+	sinceFile           string
+	sinceInventory      string
+	colorBy             string
+	colorAgeMinStr      string
+	colorAgeMin         time.Duration
+	colorAgeMaxStr      string
+	colorAgeMax         time.Duration
+	httpTimeout         time.Duration
+	showVersions        bool
+	headIfMissingSize   bool
+	columnsStr          string
+	columns             []string
+	bench               bool
+	findOrphans         string
+	showEncryption      bool
+	normalizePrefix     bool
+	allowEmptyPrefix    bool
+	hoursStr            string
+	hoursStart          int
+	hoursEnd            int
+	timezone            string
+	location            *time.Location
+	topPrefixes         int
+	queryStr            string
+	query               *jmespath.JMESPath
+	deleteVersionsStr   string
+	deleteVersionsAge   time.Duration
+	catContent          bool
+	catMaxStr           string
+	catMax              int64
+	catForce            bool
+	continueOnError     bool
+	showPercentiles     bool
+	bucketRegionsStr    string
+	bucketRegions       map[string]string
+	regionBuckets       []string
+	failLargerStr       string
+	failLarger          int64 = -1
+	exprStr             string
+	exprProgram         *vm.Program
+	appendOutput        bool
+	stripPrefix         string
+	stripSuffix         string
+	listIncomplete      bool
+	abortIncomplete     bool
+	latestPerPrefix     bool
+	latestGroupStr      string
+	latestGroup         *regexp.Regexp
+	warnDuplicateKeys   bool
+	showTree            bool
+	treeSep             string
+	newerThanObject     string
+	newerThan           time.Time
+	deleteReportPath    string
+	region              string
+	noSignRequest       bool
+	deleteFromFile      string
+	otherBucket         string
+	otherPrefix         string
+	estimateRestore     bool
+	alertObjectSizeStr  string
+	alertObjectSize     int64 = -1
+	alertTotalSizeStr   string
+	alertTotalSize      int64 = -1
+	indexRecords        bool
+	keyDepth            int
+	minKeyDepth         int
+	maxKeyDepth         int
+	setStorageClass     string
+	timeline            string
+	paletteMode         string
+	depthSummary        bool
+	redactKeys          bool
+	redactSalt          string
+	continuationToken   string
+	bandwidthLimit      string
+	sqlitePath          string
+	collapseStr         string
+	collapse            *regexp.Regexp
+	roleARN             string
+	webIdentityToken    string
+	maxRuntime          time.Duration
+	showPages           bool
+	filterURI           bool
+	formatFile          string
+	formatTemplate      executor
+	contentTypePrefix   string
+	estimateRequests    bool
+	estimatedObjects    int64
+	expectTransitionStr string
+	expectTransition    time.Duration
+	expectClass         string
+	normalizeKeys       bool
+	printRequestIDs     bool
+	smallObjectsStr     string
+	smallObjects        int64
+	teePaths            []string
+	keyTransforms       []keyTransform
+)
+
+var (
+	startTime time.Time
+	// keysExamined counts the keys listed, matched or not.
+	keysExamined atomic.Int64
+	// matchedObjects and matchedBytes count the matched objects, for the
+	// progress lines.
+	matchedObjects atomic.Int64
+	matchedBytes   atomic.Int64
+	// nextContinuationToken resumes a single listing stopped by -max-keys.
+	nextContinuationToken string
 )
 
 type Color struct {
 	R, G, B int
 }
 
-func (c Color) String() string {
-	return fmt.Sprintf("\033[38;2;%d;%d;%dm", c.R, c.G, c.B)
-}
-
 func main() {
+	startTime = time.Now()
+
 	flag.StringVar(&bucketName, "bucket", "", "S3 bucket name")
 	flag.StringVar(&bucketPrefix, "prefix", "", "S3 objects prefix")
 	flag.StringVar(&filter, "filter", "", "Filter object key")
+	flag.StringVar(&contentTypePrefix, "content-type", "", "Only list the objects whose Content-Type starts with this, such as image/, with a HeadObject request per object, which requires -prefix, -filter or -expr to bound them")
+	flag.BoolVar(&filterURI, "filter-uri", false, "Match -filter against the s3://bucket/key URI of the objects instead of their key, whether or not -full prints it")
 	flag.StringVar(&filter, "f", "", "Filter object key")
 	flag.StringVar(&minSizeStr, "minsize", "", "Minimum object size")
 	flag.StringVar(&maxSizeStr, "maxsize", "", "Maximum object size")
+	flag.StringVar(&sizeEqualStr, "size-equal", "", "Only list objects of exactly this size, 0 included")
 	flag.BoolVar(&printFullObjectPath, "full", false, "Print the full object path")
+	flag.StringVar(&delimiter, "delimiter", "", "Group keys into common prefixes using this delimiter")
+	flag.IntVar(&maxDepth, "max-depth", 0, "With -delimiter, print the total size of common prefixes up to N levels deep")
+
+	flag.StringVar(&outputFormat, "output", "text", "Output format: text, json, ndjson, csv, tsv, parquet or html")
+	flag.StringVar(&outputPath, "o", "", "Write the output to this file or s3://bucket/key URI instead of stdout")
+	flag.StringVar(&groupBy, "group-by", "", "Print a table of count and size per storage-class, extension, top-prefix or collapsed key")
+	flag.DurationVar(&pageTimeout, "page-timeout", 0, "Fail a page request taking longer than this duration")
+	flag.DurationVar(&maxRuntime, "max-runtime", 0, "Stop when the run takes longer than this duration, printing the partial results, and exit with status 124")
+	flag.IntVar(&pageRetries, "page-retries", 0, "Number of times a timed out page request is retried")
+	flag.BoolVar(&showLocks, "locks", false, "Print the Object Lock retention and legal hold of each object, requires -filter")
+	flag.Func("concurrency", "Maximum number of concurrent per-object requests or listings, or auto to adapt it to the S3 latency and throttling (default 10)", concurrencyFlag)
+	flag.BoolVar(&summaryByPrefix, "summary-by-prefix", false, "With -delimiter, print the size and count of each common prefix, largest first")
+	flag.StringVar(&colorMode, "color", "auto", "Colorize the output: always, auto or never")
+	flag.StringVar(&profile, "profile", "", "AWS profile to use from the shared configuration, overriding AWS_PROFILE")
+	flag.StringVar(&roleARN, "role-arn", "", "With -web-identity-token-file, assume this role with the web identity token, like AWS_ROLE_ARN")
+	flag.StringVar(&webIdentityToken, "web-identity-token-file", "", "With -role-arn, the file of the OIDC token to assume the role with, like AWS_WEB_IDENTITY_TOKEN_FILE")
+	flag.Int64Var(&expectMin, "expect-min", -1, "Exit with an error if fewer objects match")
+	flag.Int64Var(&expectMax, "expect-max", -1, "Exit with an error if more objects match")
+	flag.BoolVar(&showBand, "band", false, "On a terminal, draw a bar of each object size relative to the largest")
+	flag.BoolVar(&onlyPrefixes, "only-prefixes", false, "With -delimiter, print only the common prefixes")
+	flag.StringVar(&prefixFile, "prefix-file", "", "List each prefix of this newline-delimited file instead of -prefix")
+	flag.BoolVar(&printSummary, "summary", false, "Print the total count and size of the matched objects to stderr")
+	flag.IntVar(&sizeWidth, "size-width", 9, "Minimum width of the size column")
+	flag.BoolVar(&relativeKeys, "relative", false, "Print the keys relative to -prefix")
+	flag.StringVar(&metricsFile, "metrics-file", "", "Write Prometheus metrics of the matched objects to this file")
+	flag.BoolVar(&dedupeByETag, "dedupe-etag", false, "Report the objects sharing the same ETag and the bytes wasted by the copies")
+	flag.StringVar(&bucketsMatching, "buckets-matching", "", "List every bucket whose name matches this regular expression instead of -bucket")
+	flag.BoolVar(&relativeTime, "relative-time", false, "Print the modification times relative to now, such as 3d ago")
+	flag.BoolVar(&noStorageClass, "no-storage-class", false, "Do not print the storage class column")
+	flag.StringVar(&setContentType, "set-content-type", "", "Copy each object onto itself with this Content-Type")
+	flag.Var(setMetadata, "set-metadata", "Copy each object onto itself with this key=value user metadata, can be repeated")
+	flag.StringVar(&setStorageClass, "set-storage-class", "", "Copy each object onto itself in this storage class, such as STANDARD_IA or GLACIER, skipping those already in it")
+	flag.BoolVar(&dryRun, "dry-run", false, "List the objects that would be modified without modifying them")
+	flag.BoolVar(&assumeYes, "yes", false, "Do not ask for confirmation before modifying objects")
+	flag.Int64Var(&maxKeys, "max-keys", 0, "Stop after examining this many keys, matched or not")
+	flag.BoolVar(&statsJSON, "stats-json", false, "Print only the totals of the matched objects as a JSON object")
+	flag.BoolVar(&expandPrefixGlob, "expand-prefix", false, "Expand the glob metacharacters of -prefix into the matching prefixes, with one extra listing per expanded level")
+	flag.StringVar(&manifestPath, "manifest", "", "Also write the matched objects to this S3 Batch Operations CSV manifest")
+	flag.StringVar(&sqlitePath, "sqlite", "", "Also write the matched objects to the objects table of this SQLite database, replacing it")
+	flag.Int64Var(&progressEvery, "progress-every", 0, "Log a progress line to stderr every N keys examined")
+	flag.StringVar(&pathSegment, "path-contains", "", "Filter objects having this exact path segment between slashes")
+	flag.StringVar(&minAgeStr, "min-age", "", "Filter objects modified at least this long ago, such as 12h, 7d or 2w")
+	flag.StringVar(&maxAgeStr, "max-age", "", "Filter objects modified at most this long ago, such as 12h, 7d or 2w")
+	flag.BoolVar(&quiet, "quiet", false, "Do not print informational notes")
+	flag.BoolVar(&outputBuffered, "output-buffered", true, "Buffer the writes to the output when it is not a terminal")
+	flag.BoolVar(&showBucketInfo, "show-bucket-info", false, "Print the region, versioning, encryption, public access block and policy status of the bucket instead of listing it")
+	flag.StringVar(&fromInventory, "from-inventory", "", "List the objects of the CSV S3 Inventory report of this s3:// manifest.json URI instead of calling ListObjectsV2")
+	flag.BoolVar(&unordered, "unordered", false, "Write the objects needing per-object requests as soon as they are fetched instead of in key order")
+	flag.BoolVar(&compact, "compact", false, "Print only a single line with the count and total size of the matched objects")
+	flag.BoolVar(&failOnEmpty, "fail-on-empty", false, "Exit with an error if no objects match")
+	flag.StringVar(&sortBy, "sort", "", "Sort the objects by key, size (largest first) or date (newest first)")
+	flag.IntVar(&limit, "limit", 0, "With -sort, print only the first N objects, keeping only N objects in memory")
+	flag.BoolVar(&showPercent, "percent", false, "Print the size of each object as a percentage of the matched bytes, buffering the output")
+	flag.StringVar(&sinceFile, "since-file", "", "Print only the objects added, removed or changed since this listing written with -output ndjson")
+	flag.StringVar(&sinceInventory, "since-inventory-diff", "", "Like -since-file against the latest snapshot below this s3://bucket/prefix, then store this listing there as the next snapshot")
+	flag.StringVar(&colorBy, "color-by", "size", "Colorize the objects by size or age")
+	flag.StringVar(&colorAgeMinStr, "age-min", "1d", "With -color-by age, the age below which objects are green")
+	flag.StringVar(&colorAgeMaxStr, "age-max", "365d", "With -color-by age, the age above which objects are red")
+	flag.DurationVar(&httpTimeout, "http-timeout", 0, "Fail the requests not connected or answered within this duration; HTTPS_PROXY, HTTP_PROXY and NO_PROXY are honored")
+	flag.BoolVar(&showVersions, "versions", false, "List every version of the objects instead of the current ones, without the delete markers")
+	flag.BoolVar(&headIfMissingSize, "head-if-missing-size", false, "With -versions, fetch the size of the versions listed without one with a HeadObject request each")
+	flag.StringVar(&columnsStr, "columns", "", "Comma-separated, ordered columns of the text, csv and tsv outputs among bucket, key, size, modified, class, etag and version")
+	flag.BoolVar(&bench, "bench", false, "Only walk the pages and print the elapsed time and listing throughput")
+	flag.StringVar(&findOrphans, "find-orphans", "", "Print the listed objects missing from this file of expected keys, CSV manifest or s3:// inventory manifest.json, and the expected keys below -prefix missing from the bucket")
+	flag.BoolVar(&showEncryption, "show-encryption", false, "Print the server-side encryption and KMS key of each object, requires -filter")
+	flag.BoolVar(&normalizePrefix, "normalize-prefix", false, "Append a trailing slash to the prefixes, so that logs lists logs/ but not logs2/")
+	flag.BoolVar(&allowEmptyPrefix, "allow-empty-prefix", false, "Allow modifying objects without -prefix, across the whole bucket")
+	flag.StringVar(&hoursStr, "hours", "", "Filter objects modified between these hours of the day, such as 9-17 or 22-6")
+	flag.StringVar(&timezone, "timezone", "UTC", "Time zone of -hours and -timeline, such as Europe/Paris or Local")
+	flag.IntVar(&topPrefixes, "top-prefixes", 0, "Print the N common prefixes holding the most bytes, splitting the keys on -delimiter or /")
+	flag.StringVar(&queryStr, "query", "", "JMESPath expression applied to the records of -output json, or to each record of -output ndjson, like the AWS CLI --query")
+	flag.StringVar(&deleteVersionsStr, "delete-versions-older-than", "", "Delete the noncurrent versions modified longer ago than this, such as 90d, never the latest versions")
+	flag.BoolVar(&catContent, "cat", false, "Print the content of the matched objects, each after a header line")
+	flag.StringVar(&catMaxStr, "cat-max", "1MB", "Largest object printed by -cat")
+	flag.BoolVar(&catForce, "cat-force", false, "Print with -cat the objects that are binary or larger than -cat-max")
+	flag.BoolVar(&continueOnError, "continue-on-error", false, "Log the errors listing a bucket or prefix and proceed with the others, exiting with an error at the end")
+	flag.BoolVar(&showPercentiles, "percentiles", false, "Print the p50, p90, p95 and p99 and largest sizes of the matched objects, keeping every size in memory")
+	flag.StringVar(&bucketRegionsStr, "bucket-regions", "", "Comma-separated bucket=region pairs, listed instead of -bucket, or giving the regions of the listed buckets without looking them up")
+	flag.StringVar(&failLargerStr, "fail-if-larger-than", "", "Exit with an error if the matched objects total more than this size, such as 10GB")
+	flag.StringVar(&exprStr, "expr", "", `Only list the objects matching this expr-lang expression over bucket, uri, key, size, age, modified, class, etag and ext, where sizes like 100MB and durations like 30d can be written as such and ~ matches a regular expression, as in 'size > 100MB && key ~ "\.log$" && age > 30d'`)
+	flag.BoolVar(&appendOutput, "append", false, "Append to the -o file instead of overwriting it, without repeating the CSV header")
+	flag.StringVar(&stripPrefix, "strip-prefix", "", "Remove this string from the start of the printed keys")
+	flag.StringVar(&stripSuffix, "strip-suffix", "", "Remove this string from the end of the printed keys")
+	flag.BoolVar(&listIncomplete, "list-incomplete-uploads", false, "List the incomplete multipart uploads below -prefix, filtered by the key filters and by -min-age and -max-age on their initiation time, instead of the objects")
+	flag.BoolVar(&abortIncomplete, "abort-incomplete", false, "Abort the uploads listed by -list-incomplete-uploads")
+	flag.BoolVar(&latestPerPrefix, "only-latest-per-prefix", false, "Only print the most recently modified object below each directory")
+	flag.StringVar(&latestGroupStr, "latest-group-regex", "", "With -only-latest-per-prefix, group the keys by the first capture group of this regular expression instead of their directory")
+	flag.BoolVar(&warnDuplicateKeys, "warn-duplicate-keys", false, "With -versions, warn about the keys having several versions with the same size and ETag, and the bytes they waste")
+	flag.BoolVar(&showTree, "tree", false, "Print the matched objects as an indented tree of the -delimiter directories, / by default, with the size of each")
+	flag.StringVar(&newerThanObject, "newer-than-object", "", "Only list the objects modified after this key of -bucket, or s3://bucket/key URI")
+	flag.StringVar(&deleteReportPath, "delete-report", "", "Write the deleted and failed versions of -delete-versions-older-than and the totals to this file, as JSON if it ends with .json, else as CSV")
+	flag.StringVar(&region, "region", "", "AWS region of the requests, instead of the configured one")
+	flag.BoolVar(&noSignRequest, "no-sign-request", false, "Send anonymous requests to public buckets, without credentials, requires -region")
+	flag.StringVar(&deleteFromFile, "delete-from-file", "", "Delete exactly the keys of -bucket listed in this newline-delimited file, or the bucket,key[,version_id] rows of this .csv manifest, instead of listing")
+	flag.StringVar(&otherBucket, "other-bucket", "", "Compare -bucket with this bucket, printing the keys only in -bucket (<), only in this one (>) and those of differing size or ETag (~)")
+	flag.StringVar(&otherPrefix, "other-prefix", "", "With -other-bucket, compare -prefix with this prefix of the other bucket")
+	flag.BoolVar(&estimateRestore, "estimate-restore-cost", false, "Print the approximate cost of restoring the matched GLACIER and DEEP_ARCHIVE objects with each retrieval tier instead of listing them")
+	flag.Func("restore-rates", "With -estimate-restore-cost, comma-separated CLASS.Tier=price per GB overriding the approximate prices, such as GLACIER.Standard=0.012", parseRestoreRates)
+	flag.StringVar(&alertObjectSizeStr, "alert-object-size", "", "Monitoring check: print only the objects larger than this size, and exit with an error if there are any")
+	flag.StringVar(&alertTotalSizeStr, "alert-total-size", "", "Monitoring check: exit with an error, printing the largest objects, if the matched objects total more than this size")
+	flag.BoolVar(&indexRecords, "index", false, "Add to each JSON record an index field numbering the records from 0 in output order")
+	flag.IntVar(&keyDepth, "depth", 0, "Match only the keys of exactly N path segments below -prefix, counting the slashes")
+	flag.IntVar(&minKeyDepth, "min-depth", 0, "Match only the keys of at least N path segments below -prefix")
+	flag.IntVar(&maxKeyDepth, "max-depth-keys", 0, "Match only the keys of at most N path segments below -prefix")
+	flag.StringVar(&timeline, "timeline", "", "Print the count and size of the matched objects per hour, day, week or month of modification instead of listing them")
+	flag.StringVar(&paletteMode, "color-mode", "auto", "Colors the terminal supports: truecolor, 256, 16, or auto to detect them from COLORTERM and TERM")
+	flag.BoolVar(&depthSummary, "depth-summary", false, "Print the count and size of the matched objects per number of path segments below -prefix instead of listing them")
+	flag.BoolVar(&redactKeys, "redact", false, "Replace each path segment of the keys below -prefix with a salted hash, keeping the extensions, to share a listing without its names")
+	flag.StringVar(&redactSalt, "redact-salt", "", "With -redact, hash with this salt so that the reports sharing it are consistent, instead of a random one")
+	flag.StringVar(&continuationToken, "continuation-token", "", "Start the listing from this ListObjectsV2 continuation token, as printed when -max-keys stops a listing. Tokens are opaque and only valid for the bucket and prefix they were printed for")
+	flag.StringVar(&bandwidthLimit, "bandwidth-limit", "", "Throttle the downloads of -cat and -from-inventory to this aggregate rate, such as 10MB/s")
+	flag.StringVar(&collapseStr, "collapse-regex", "[0-9]+", "With -group-by collapsed, group the keys with the matches of this regular expression replaced by *, like app/*/*/*/part-*.log for daily logs")
+	flag.BoolVar(&showPages, "show-pages", false, "Log a line per page listed with its number, key count, truncation and continuation token, to debug the pagination")
+	flag.StringVar(&formatFile, "format-file", "", "Print the matched objects with the Go template of this file, executed once over .Objects, .Prefixes and the .Count and .Size totals, with the size, date, age and uri functions; .html files are HTML templates")
+	flag.BoolVar(&estimateRequests, "estimate-requests", false, "Print the approximate number and cost of the requests the run would make, counted from the first page of each listing, instead of running it")
+	flag.Int64Var(&estimatedObjects, "estimated-objects", 0, "With -estimate-requests, the approximate number of objects to list when they span more than one page")
+	flag.StringVar(&expectTransitionStr, "expect-transition-after", "", "Lifecycle audit: only list the objects older than this age still in STANDARD, and print how much more they cost than in -expect-transition-to")
+	flag.StringVar(&expectClass, "expect-transition-to", "STANDARD_IA", "With -expect-transition-after, the storage class the lifecycle rule transitions to")
+	flag.BoolVar(&normalizeKeys, "normalize-unicode-keys", false, "Print the keys in Unicode NFC for the combining characters to display consistently, the keys are matched and fetched as they are")
+	flag.BoolVar(&printRequestIDs, "print-request-ids", false, "Log the x-amz-request-id and x-amz-id-2 of the failed S3 requests, for AWS support cases")
+	flag.StringVar(&smallObjectsStr, "small-objects", "", "Print the count of the matched objects smaller than this size per storage class, and what their minimum billable size costs, instead of listing them")
+	flag.Func("min-billable", "With -small-objects, comma-separated CLASS=size minimum billable sizes overriding the STANDARD_IA, ONEZONE_IA and GLACIER_IR 128KB ones", parseMinBillable)
+	flag.Func("tee", "Also write the objects to this file or s3://bucket/key URI, as csv, tsv, json, ndjson, parquet or html by its extension, else as text, while still printing them: -tee report.csv is -o report.csv -output csv alongside the terminal output. Can be repeated", func(path string) error {
+		if slices.Contains(teePaths, path) {
+			return fmt.Errorf("%s is given twice", path)
+		}
+		teePaths = append(teePaths, path)
+		return nil
+	})
+	flag.Func("key-transform", "Print the keys with this sed-like s/regexp/replacement/[g] substitution made, \\1 referring to the first group, to preview a renaming. Only the output is affected, can be repeated", func(value string) error {
+		t, err := parseKeyTransform(value)
+		if err != nil {
+			return err
+		}
+		keyTransforms = append(keyTransforms, t)
+		return nil
+	})
 
 	flag.Parse()
 
-	if bucketName == "" {
+	sources := 0
+	for _, source := range []string{bucketName, bucketsMatching, fromInventory} {
+		if source != "" {
+			sources++
+		}
+	}
+	if bucketRegionsStr != "" {
+		var err error
+		if bucketRegions, regionBuckets, err = parseBucketRegions(bucketRegionsStr); err != nil {
+			log.Fatalln("error: -bucket-regions:", err)
+		}
+	}
+	if deleteFromFile != "" && (sources > 1 || bucketsMatching != "" || fromInventory != "") {
+		log.Fatalln("error: -delete-from-file cannot be used with -buckets-matching or -from-inventory")
+	}
+	if deleteFromFile != "" && sources == 0 {
+		// The buckets can all be named by a .csv manifest.
+		sources = 1
+	}
+	if sources > 1 || sources == 0 && len(regionBuckets) == 0 {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if bucketName == "" && (maxDepth > 0 || summaryByPrefix || topPrefixes > 0) {
+		log.Fatalln("error: -max-depth, -summary-by-prefix and -top-prefixes require -bucket")
+	}
+	if topPrefixes > 0 && delimiter == "" {
+		delimiter = "/"
+	}
+	if fromInventory != "" && (delimiter != "" || prefixFile != "" || expandPrefixGlob) {
+		log.Fatalln("error: -from-inventory cannot be used with -delimiter, -prefix-file or -expand-prefix")
+	}
+
+	if maxDepth > 0 && delimiter == "" {
+		log.Fatalln("error: -max-depth requires -delimiter")
+	}
+	if summaryByPrefix && delimiter == "" {
+		log.Fatalln("error: -summary-by-prefix requires -delimiter")
+	}
+	if onlyPrefixes && delimiter == "" {
+		log.Fatalln("error: -only-prefixes requires -delimiter")
+	}
+
+	if prefixFile != "" && bucketPrefix != "" {
+		log.Fatalln("error: -prefix and -prefix-file are mutually exclusive")
+	}
+	if prefixFile != "" && relativeKeys {
+		log.Fatalln("error: -relative cannot be used with -prefix-file")
+	}
+	if prefixFile != "" && (keyDepth != 0 || minKeyDepth != 0 || maxKeyDepth != 0) {
+		log.Fatalln("error: -depth, -min-depth and -max-depth-keys cannot be used with -prefix-file")
+	}
+	if keyDepth < 0 || minKeyDepth < 0 || maxKeyDepth < 0 {
+		log.Fatalln("error: -depth, -min-depth and -max-depth-keys cannot be negative")
+	}
+	if normalizePrefix {
+		bucketPrefix = withTrailingSlash(bucketPrefix)
+	}
+	if modifiesObjects() && bucketPrefix == "" && prefixFile == "" && !allowEmptyPrefix {
+		log.Println("warning: without -prefix, every object of the bucket passing the filters would be modified")
+		log.Fatalln("error: refusing to modify objects without -prefix, use -allow-empty-prefix to modify the whole bucket")
+	}
+
+	if colorMode != "always" && colorMode != "auto" && colorMode != "never" {
+		log.Fatalln("error: -color must be always, auto or never")
+	}
+	switch paletteMode {
+	case "auto":
+		palette = detectPalette()
+	case paletteTrueColor, palette256, palette16:
+		palette = paletteMode
+	default:
+		log.Fatalln("error: -color-mode must be truecolor, 256, 16 or auto")
+	}
+	if colorBy != "size" && colorBy != "age" {
+		log.Fatalln("error: -color-by must be size or age")
+	}
+	if showLocks && filter == "" {
+		log.Fatalln("error: -locks requires -filter")
+	}
+	if showEncryption && filter == "" {
+		log.Fatalln("error: -show-encryption requires -filter")
+	}
+	if concurrency < 1 {
+		log.Fatalln("error: -concurrency must be at least 1")
+	}
+	if compact && statsJSON {
+		log.Fatalln("error: -compact and -stats-json are mutually exclusive")
+	}
+	if limit > 0 && sortBy == "" {
+		log.Fatalln("error: -limit requires -sort")
+	}
+	if groupBy != "" && outputFormat != "text" && outputFormat != "json" {
+		log.Fatalln("error: -group-by requires -output text or json")
+	}
+	if sortBy != "" && (groupBy != "" || dedupeByETag || statsJSON || compact) {
+		log.Fatalln("error: -sort cannot be used with -group-by, -dedupe-etag, -stats-json or -compact")
+	}
+	if sinceFile != "" && sinceInventory != "" {
+		log.Fatalln("error: -since-file and -since-inventory-diff are mutually exclusive")
+	}
+	if (sinceFile != "" || sinceInventory != "") && outputFormat == "parquet" {
+		log.Fatalln("error: -since-file and -since-inventory-diff cannot be used with -output parquet")
+	}
+	if setStorageClass != "" {
+		setStorageClass = strings.ToUpper(setStorageClass)
+		if !slices.Contains(types.StorageClass("").Values(), types.StorageClass(setStorageClass)) {
+			log.Fatalf("error: unknown storage class %q for -set-storage-class", setStorageClass)
+		}
+	}
+	if deleteVersionsStr != "" {
+		deleteVersionsAge = mustParseAge("-delete-versions-older-than", deleteVersionsStr)
+		if deleteVersionsAge <= 0 {
+			log.Fatalln("error: -delete-versions-older-than must be positive")
+		}
+		if rewritesMetadata() {
+			log.Fatalln("error: -delete-versions-older-than cannot be used with -set-content-type, -set-metadata or -set-storage-class")
+		}
+		showVersions = true
+	}
+	// The objects are modified before being written, so the writers printing
+	// only some of them would hide what is modified, in the -dry-run preview
+	// too.
+	if sortBy != "" && (rewritesMetadata() || deletesVersions()) {
+		log.Fatalln("error: -sort and -limit cannot be used with -set-content-type, -set-metadata, -set-storage-class or -delete-versions-older-than")
+	}
+	if deleteReportPath != "" {
+		if !deletesVersions() && deleteFromFile == "" {
+			log.Fatalln("error: -delete-report requires -delete-versions-older-than or -delete-from-file")
+		}
+		deletions = &deleteReport{}
+	}
+	if warnDuplicateKeys && !showVersions {
+		log.Fatalln("error: -warn-duplicate-keys requires -versions")
+	}
+	if headIfMissingSize && !showVersions {
+		log.Fatalln("error: -head-if-missing-size requires -versions")
+	}
+	if showVersions && (fromInventory != "" || showLocks || showEncryption || rewritesMetadata() || sinceFile != "" || sinceInventory != "") {
+		log.Fatalln("error: -versions cannot be used with -from-inventory, -locks, -show-encryption, -set-content-type, -set-metadata, -set-storage-class, -since-file or -since-inventory-diff")
+	}
+	if columnsStr != "" {
+		var err error
+		if columns, err = parseColumns(columnsStr); err != nil {
+			log.Fatalln("error: -columns:", err)
+		}
+		if showBand || showPercent {
+			log.Fatalln("error: -columns cannot be used with -band or -percent")
+		}
+	}
+	if findOrphans != "" && bucketName == "" {
+		log.Fatalln("error: -find-orphans requires -bucket")
+	}
+	if findOrphans != "" && (sinceFile != "" || sinceInventory != "") {
+		log.Fatalln("error: -find-orphans cannot be used with -since-file or -since-inventory-diff")
+	}
+	if bench && (rewritesMetadata() || deletesVersions()) {
+		log.Fatalln("error: -bench cannot be used with -set-content-type, -set-metadata, -set-storage-class or -delete-versions-older-than")
+	}
+	if indexRecords && outputFormat != "json" && outputFormat != "ndjson" {
+		log.Fatalln("error: -index requires -output json or ndjson")
+	}
+	if queryStr != "" {
+		if outputFormat != "json" && outputFormat != "ndjson" {
+			log.Fatalln("error: -query requires -output json or ndjson")
+		}
+		var err error
+		if query, err = jmespath.Compile(queryStr); err != nil {
+			log.Fatalln("error: -query:", err)
+		}
+	}
+	if catContent {
+		if outputFormat != "text" || len(columns) > 0 {
+			log.Fatalln("error: -cat requires -output text and no -columns")
+		}
+		if statsJSON || compact || bench || groupBy != "" || dedupeByETag || findOrphans != "" || sinceFile != "" || sinceInventory != "" {
+			log.Fatalln("error: -cat cannot be used with -stats-json, -compact, -bench, -group-by, -dedupe-etag, -find-orphans, -since-file or -since-inventory-diff")
+		}
+		catMax = int64(datasize.MustParseString(catMaxStr).Bytes())
+	}
+	if abortIncomplete {
+		listIncomplete = true
+	}
+	if listIncomplete && (fromInventory != "" || rewritesMetadata() || deletesVersions() || showBucketInfo) {
+		log.Fatalln("error: -list-incomplete-uploads cannot be used with -from-inventory, -set-content-type, -set-metadata, -set-storage-class, -delete-versions-older-than or -show-bucket-info")
+	}
+	// The uploads have neither a size nor the other properties of an object.
+	if listIncomplete && (minSizeStr != "" || maxSizeStr != "" || sizeEqualStr != "" || exprStr != "" || contentTypePrefix != "" || expectTransitionStr != "") {
+		log.Fatalln("error: -list-incomplete-uploads cannot be used with -minsize, -maxsize, -size-equal, -expr, -content-type or -expect-transition-after")
+	}
+	if groupBy == "collapsed" {
+		var err error
+		if collapse, err = regexp.Compile(collapseStr); err != nil {
+			log.Fatalln("error: invalid -collapse-regex:", err)
+		}
+	}
+	if latestGroupStr != "" {
+		var err error
+		if latestGroup, err = regexp.Compile(latestGroupStr); err != nil {
+			log.Fatalln("error: invalid -latest-group-regex:", err)
+		}
+		latestPerPrefix = true
+	}
+	if latestPerPrefix && (groupBy != "" || dedupeByETag || statsJSON || compact || findOrphans != "" || sinceFile != "" || sinceInventory != "") {
+		log.Fatalln("error: -only-latest-per-prefix cannot be used with -group-by, -dedupe-etag, -stats-json, -compact, -find-orphans, -since-file or -since-inventory-diff")
+	}
+	// Like -limit, it would hide most of the modified objects.
+	if latestPerPrefix && (rewritesMetadata() || deletesVersions()) {
+		log.Fatalln("error: -only-latest-per-prefix cannot be used with -set-content-type, -set-metadata, -set-storage-class or -delete-versions-older-than")
+	}
+	if showTree {
+		if outputFormat != "text" || catContent || groupBy != "" || dedupeByETag || statsJSON || compact || sortBy != "" || findOrphans != "" || sinceFile != "" || sinceInventory != "" {
+			log.Fatalln("error: -tree requires -output text and cannot be used with -cat, -group-by, -dedupe-etag, -stats-json, -compact, -sort, -find-orphans, -since-file or -since-inventory-diff")
+		}
+		// The tree is built from the whole listing, split on the delimiter.
+		treeSep, delimiter = cmp.Or(delimiter, "/"), ""
+	}
+	if noSignRequest && (region == "" || bucketsMatching != "") {
+		log.Fatalln("error: -no-sign-request requires -region and cannot be used with -buckets-matching")
+	}
+	if estimateRestore && (outputFormat != "text" || catContent || showTree || groupBy != "" || dedupeByETag || statsJSON || compact || bench) {
+		log.Fatalln("error: -estimate-restore-cost requires -output text and cannot be used with -cat, -tree, -group-by, -dedupe-etag, -stats-json, -compact or -bench")
+	}
+	if slices.Contains(teePaths, outputPath) {
+		log.Fatalln("error: -tee cannot be the -o file")
+	}
+	if smallObjectsStr != "" {
+		smallObjects = int64(datasize.MustParseString(smallObjectsStr).Bytes())
+		if outputFormat != "text" || catContent || showTree || estimateRestore || timeline != "" || depthSummary || formatFile != "" || groupBy != "" || dedupeByETag || statsJSON || compact || bench {
+			log.Fatalln("error: -small-objects requires -output text and cannot be used with -cat, -tree, -estimate-restore-cost, -timeline, -depth-summary, -format-file, -group-by, -dedupe-etag, -stats-json, -compact or -bench")
+		}
+	}
+	if timeline != "" && (outputFormat != "text" || catContent || showTree || estimateRestore || groupBy != "" || dedupeByETag || statsJSON || compact || bench) {
+		log.Fatalln("error: -timeline requires -output text and cannot be used with -cat, -tree, -estimate-restore-cost, -group-by, -dedupe-etag, -stats-json, -compact or -bench")
+	}
+	if formatFile != "" {
+		if outputFormat != "text" || catContent || showTree || estimateRestore || timeline != "" || depthSummary || groupBy != "" || dedupeByETag || statsJSON || compact || bench {
+			log.Fatalln("error: -format-file requires -output text and cannot be used with -cat, -tree, -estimate-restore-cost, -timeline, -depth-summary, -group-by, -dedupe-etag, -stats-json, -compact or -bench")
+		}
+		var err error
+		if formatTemplate, err = parseTemplate(formatFile); err != nil {
+			log.Fatalln("error: -format-file:", err)
+		}
+	}
+	if depthSummary {
+		if outputFormat != "text" || catContent || showTree || estimateRestore || timeline != "" || groupBy != "" || dedupeByETag || statsJSON || compact || bench {
+			log.Fatalln("error: -depth-summary requires -output text and cannot be used with -cat, -tree, -estimate-restore-cost, -timeline, -group-by, -dedupe-etag, -stats-json, -compact or -bench")
+		}
+		if prefixFile != "" {
+			log.Fatalln("error: -depth-summary cannot be used with -prefix-file")
+		}
+	}
+	if continuationToken != "" && (!singleListing() || showVersions || fromInventory != "" || otherBucket != "" || deleteFromFile != "") {
+		log.Fatalln("error: -continuation-token requires -bucket and cannot be used with -prefix-file, -expand-prefix, -versions, -from-inventory, -other-bucket or -delete-from-file")
+	}
+	if bandwidthLimit != "" {
+		rate, err := parseBandwidth(bandwidthLimit)
+		if err != nil {
+			log.Fatalln("error: -bandwidth-limit:", err)
+		}
+		bandwidth = &bandwidthLimiter{rate: rate}
+	}
+	if (roleARN == "") != (webIdentityToken == "") {
+		log.Fatalln("error: -role-arn and -web-identity-token-file require each other")
+	}
+	if roleARN != "" && (noSignRequest || profile != "") {
+		log.Fatalln("error: -role-arn cannot be used with -no-sign-request or -profile")
+	}
+	if contentTypePrefix != "" {
+		if bucketPrefix == "" && prefixFile == "" && filter == "" && exprStr == "" {
+			log.Fatalln("error: -content-type makes a HeadObject request per object, bound them with -prefix, -prefix-file, -filter or -expr")
+		}
+	}
+	if expectTransitionStr != "" {
+		expectTransition = mustParseAge("-expect-transition-after", expectTransitionStr)
+		expectClass = strings.ToUpper(expectClass)
+		if _, ok := storagePrices[types.StorageClass(expectClass)]; !ok {
+			log.Fatalf("error: unknown storage class %q for -expect-transition-to", expectClass)
+		}
+		if expectClass == string(types.StorageClassStandard) {
+			log.Fatalln("error: -expect-transition-to must be another class than STANDARD")
+		}
+		if showVersions || rewritesMetadata() {
+			log.Fatalln("error: -expect-transition-after cannot be used with -versions, -set-content-type, -set-metadata or -set-storage-class")
+		}
+	}
+	if estimatedObjects != 0 && !estimateRequests {
+		log.Fatalln("error: -estimated-objects requires -estimate-requests")
+	}
+	if estimateRequests && (fromInventory != "" || deleteFromFile != "" || otherBucket != "" || listIncomplete || showBucketInfo) {
+		log.Fatalln("error: -estimate-requests cannot be used with -from-inventory, -delete-from-file, -other-bucket, -list-incomplete-uploads or -show-bucket-info")
+	}
+	if redactSalt != "" && !redactKeys {
+		log.Fatalln("error: -redact-salt requires -redact")
+	}
+	if redactKeys && (catContent || maxDepth > 0 || summaryByPrefix || topPrefixes > 0) {
+		log.Fatalln("error: -redact cannot be used with -cat, -max-depth, -summary-by-prefix or -top-prefixes")
+	}
+	if redactKeys {
+		keyRedactor = newRedactor(redactSalt)
+	}
+	if otherPrefix != "" && otherBucket == "" {
+		log.Fatalln("error: -other-prefix requires -other-bucket")
+	}
+	if otherBucket != "" {
+		if bucketName == "" || prefixFile != "" || expandPrefixGlob || delimiter != "" || showVersions {
+			log.Fatalln("error: -other-bucket requires -bucket and cannot be used with -prefix-file, -expand-prefix, -delimiter or -versions")
+		}
+		if outputFormat == "parquet" || rewritesMetadata() || findOrphans != "" || sinceFile != "" || sinceInventory != "" || showTree || latestPerPrefix {
+			log.Fatalln("error: -other-bucket cannot be used with -output parquet, -set-content-type, -set-metadata, -set-storage-class, -find-orphans, -since-file, -since-inventory-diff, -tree or -only-latest-per-prefix")
+		}
+	}
+	if showBucketInfo && (rewritesMetadata() || deletesVersions()) {
+		log.Fatalln("error: -show-bucket-info cannot be used with -set-content-type, -set-metadata, -set-storage-class or -delete-versions-older-than")
+	}
 
 	if maxSizeStr != "" {
 		maxSize = int64(datasize.MustParseString(maxSizeStr).Bytes())
@@ -65,70 +687,967 @@ func main() {
 		minSize = int64(datasize.MustParseString(minSizeStr).Bytes())
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if appendOutput {
+		if outputPath == "" || strings.HasPrefix(outputPath, "s3://") {
+			log.Fatalln("error: -append requires -o with a local file")
+		}
+		if outputFormat == "json" || outputFormat == "parquet" {
+			log.Fatalln("error: -append cannot be used with -output json or parquet, use ndjson")
+		}
+	}
+	if exprStr != "" {
+		var err error
+		if exprProgram, err = compileExpr(exprStr); err != nil {
+			log.Fatalln("error: -expr:", err)
+		}
+	}
+	if alertObjectSizeStr != "" {
+		alertObjectSize = int64(datasize.MustParseString(alertObjectSizeStr).Bytes())
+	}
+	if alertTotalSizeStr != "" {
+		alertTotalSize = int64(datasize.MustParseString(alertTotalSizeStr).Bytes())
+	}
+	// The alerts print only the offending objects, hiding most of the
+	// modified ones.
+	if (alertObjectSize >= 0 || alertTotalSize >= 0) && (rewritesMetadata() || deletesVersions()) {
+		log.Fatalln("error: -alert-object-size and -alert-total-size cannot be used with -set-content-type, -set-metadata, -set-storage-class or -delete-versions-older-than")
+	}
+	if failLargerStr != "" {
+		failLarger = int64(datasize.MustParseString(failLargerStr).Bytes())
+	}
+	if sizeEqualStr != "" {
+		sizeEqual = int64(datasize.MustParseString(sizeEqualStr).Bytes())
+	}
+
+	if minAgeStr != "" {
+		minAge = mustParseAge("-min-age", minAgeStr)
+	}
+	if maxAgeStr != "" {
+		maxAge = mustParseAge("-max-age", maxAgeStr)
+	}
+	if hoursStr != "" {
+		var err error
+		if hoursStart, hoursEnd, err = parseHours(hoursStr); err != nil {
+			log.Fatalln("error: -hours:", err)
+		}
+	}
+	if hoursStr != "" || timeline != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			log.Fatalln("error: -timezone:", err)
+		}
+	}
+	colorAgeMin = mustParseAge("-age-min", colorAgeMinStr)
+	colorAgeMax = mustParseAge("-age-max", colorAgeMaxStr)
+	if colorAgeMax <= colorAgeMin {
+		log.Fatalln("error: -age-max must be greater than -age-min")
+	}
+
+	ctx := context.Background()
+	if maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, startTime.Add(maxRuntime))
+		defer cancel()
+	}
+
+	cfg, err := loadConfig(ctx)
 	if err != nil {
 		log.Fatalln("error:", err)
 	}
+	if newerThanObject != "" {
+		newerThan, err = referenceTime(ctx, cfg, newerThanObject)
+		if err != nil {
+			fatalClientError(fmt.Errorf("-newer-than-object: %w", err))
+		}
+	}
 
-	client := s3.NewFromConfig(cfg)
+	if maxDepth > 0 || summaryByPrefix || topPrefixes > 0 {
+		client, err := newBucketClient(ctx, cfg, bucketName)
+		if err != nil {
+			fatalClientError(err)
+		}
+		if maxDepth > 0 {
+			total, err := diskUsage(ctx, client, bucketName, bucketPrefix, 0)
+			if err != nil {
+				log.Fatalln("error:", err)
+			}
+			printUsage(total, bucketName, bucketPrefix)
+			return
+		}
+		summaries, err := summarizePrefixes(ctx, client, bucketName, bucketPrefix)
+		if err != nil {
+			log.Fatalln("error:", err)
+		}
+		if topPrefixes > 0 && len(summaries) > topPrefixes {
+			summaries = summaries[:topPrefixes]
+		}
+		printPrefixSummary(summaries, bucketName)
+		return
+	}
 
-	response, err := client.GetBucketLocation(context.Background(), &s3.GetBucketLocationInput{
-		Bucket: &bucketName,
-	})
-	if err != nil {
-		log.Fatalln("Failed to get bucket location, ", err)
+	buckets := []string{bucketName}
+	var inventory *inventoryManifest
+	if fromInventory != "" {
+		inventory, err = readInventoryManifest(ctx, cfg, fromInventory)
+		if err != nil {
+			fatalClientError(err)
+		}
+		bucketName = inventory.SourceBucket
+		buckets = []string{bucketName}
+	}
+	if sources == 0 {
+		buckets = regionBuckets
+	}
+	if bucketsMatching != "" {
+		re, err := regexp.Compile(bucketsMatching)
+		if err != nil {
+			log.Fatalln("error: invalid -buckets-matching:", err)
+		}
+		buckets, err = matchingBuckets(ctx, cfg, re)
+		if err != nil {
+			fatalClientError(err)
+		}
 	}
-	cfg.Region = string(response.LocationConstraint)
-	client = s3.NewFromConfig(cfg)
 
-	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Bucket: &bucketName,
-		Prefix: &bucketPrefix,
-	})
+	if len(buckets) > 1 {
+		prefetchRegions(ctx, cfg, buckets)
+	}
 
-	white := Color{255, 255, 255}
-	darkRed := Color{220, 0, 0}
-	isTerm := term.IsTerminal(int(os.Stdout.Fd()))
+	if showBucketInfo {
+		for i, bucket := range buckets {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := printBucketInfo(ctx, os.Stdout, cfg, bucket); err != nil {
+				fatalClientError(err)
+			}
+		}
+		return
+	}
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+	prefixes := []string{bucketPrefix}
+	if prefixFile != "" {
+		prefixes, err = readPrefixFile(prefixFile)
 		if err != nil {
 			log.Fatalln("error:", err)
 		}
-		for _, obj := range page.Contents {
-			key := *obj.Key
-			size := *obj.Size
+		if normalizePrefix {
+			for i, prefix := range prefixes {
+				prefixes[i] = withTrailingSlash(prefix)
+			}
+		}
+	}
 
-			if !strings.Contains(key, filter) {
-				continue
+	if deleteFromFile != "" {
+		keys, err := readDeleteList(deleteFromFile)
+		if err != nil {
+			log.Fatalf("error: -delete-from-file %s: %v", deleteFromFile, err)
+		}
+		if len(keys) == 0 {
+			log.Fatalf("error: -delete-from-file %s lists no keys", deleteFromFile)
+		}
+		if dryRun {
+			log.Printf("dry run: listing the %d keys that would be deleted", len(keys))
+			printListedKeys(os.Stdout, keys)
+			return
+		}
+		if !confirm(fmt.Sprintf("About to delete the %s keys listed in %s. Continue?", formatCount(int64(len(keys))), deleteFromFile)) {
+			log.Fatalln("aborted")
+		}
+		checkCredentialsExpiry(ctx, cfg)
+		onInterrupt(writeInterruptedReport)
+		failed, err := deleteListedKeys(ctx, cfg, keys)
+		if deletions != nil {
+			if err := deletions.write(deleteReportPath); err != nil {
+				log.Fatalln("error: failed to write the deletion report:", err)
 			}
-			if (minSize != 0 && size < minSize) || (maxSize != 0 && size > maxSize) {
-				continue
+		}
+		if err != nil {
+			fatalClientError(err)
+		}
+		if printSummary {
+			fmt.Fprintf(os.Stderr, "%d deleted, %d failed\n", int64(len(keys))-failed, failed)
+		}
+		if failed > 0 {
+			log.Fatalf("error: failed to delete %d keys", failed)
+		}
+		return
+	}
+
+	if listIncomplete {
+		var uploads []incompleteUpload
+		for _, bucket := range buckets {
+			client, err := newBucketClient(ctx, cfg, bucket)
+			if err != nil {
+				fatalClientError(fmt.Errorf("%s: %w", bucket, err))
 			}
-			if printFullObjectPath {
-				key = fmt.Sprintf("s3://%s/%s", bucketName, key)
+			for _, prefix := range prefixes {
+				found, err := listIncompleteUploads(ctx, client, bucket, prefix)
+				if err != nil {
+					fatalClientError(err)
+				}
+				uploads = append(uploads, found...)
 			}
+		}
+		printIncompleteUploads(os.Stdout, uploads)
+		if printSummary {
+			fmt.Fprintf(os.Stderr, "%d incomplete uploads\n", len(uploads))
+		}
+		if !abortIncomplete || len(uploads) == 0 {
+			return
+		}
+		if dryRun {
+			log.Printf("dry run: not aborting the %d incomplete uploads", len(uploads))
+			return
+		}
+		if !confirm(fmt.Sprintf("About to abort %s incomplete uploads in %s. Continue?", formatCount(int64(len(uploads))), targetDescription())) {
+			log.Fatalln("aborted")
+		}
+		failed, err := abortIncompleteUploads(ctx, cfg, uploads)
+		if err != nil {
+			fatalClientError(err)
+		}
+		if failed > 0 {
+			log.Fatalf("error: failed to abort %d uploads", failed)
+		}
+		return
+	}
 
-			if isTerm {
-				color := white
-				if size <= 1024*1024 {
-					color = white
-				} else if size >= maxObjectSizeLimit {
-					color = darkRed
-				} else {
-					factor := float64(size) / float64(maxObjectSizeLimit)
-					color = interpolateColor(factor, white, darkRed)
+	if estimateRequests {
+		estimate, err := estimateObjects(ctx, cfg, buckets, prefixes)
+		if err != nil {
+			fatalClientError(err)
+		}
+		printRequestEstimate(os.Stdout, targetDescription(), estimate)
+		return
+	}
+
+	if rewritesMetadata() || deletesVersions() {
+		dryRunNote := "dry run: listing the objects whose metadata would be rewritten"
+		prompt := fmt.Sprintf("Rewrite the metadata of the matching objects in %s?", targetDescription())
+		action, noun, destination := "rewrite the metadata of", "objects", ""
+		if transitionsOnly() {
+			dryRunNote = fmt.Sprintf("dry run: listing the objects that would be transitioned to %s", setStorageClass)
+			prompt = fmt.Sprintf("Transition the matching objects in %s to %s?", targetDescription(), setStorageClass)
+			action, destination = "transition", " to "+setStorageClass
+		}
+		if deletesVersions() {
+			dryRunNote = fmt.Sprintf("dry run: listing the noncurrent versions older than %s that would be deleted", deleteVersionsStr)
+			prompt = fmt.Sprintf("Delete the noncurrent versions older than %s in %s?", deleteVersionsStr, targetDescription())
+			action, noun = "delete", "noncurrent versions"
+		}
+		if dryRun {
+			log.Println(dryRunNote)
+		} else if !assumeYes {
+			if inventory == nil && !(expandPrefixGlob && hasGlob(bucketPrefix)) {
+				preview, exact, err := previewMatches(ctx, cfg, buckets, prefixes)
+				if err != nil {
+					fatalClientError(err)
 				}
-				fmt.Print(color)
+				prompt = fmt.Sprintf("About to %s %s in %s%s. Continue?", action, describePreview(preview, exact, noun), targetDescription(), destination)
+				if exact {
+					deleteEstimate = preview.count
+				}
+			}
+			if !confirm(prompt) {
+				log.Fatalln("aborted")
+			}
+		}
+		if deletesVersions() && !dryRun {
+			checkCredentialsExpiry(ctx, cfg)
+			deletionStart = time.Now()
+		}
+	}
+
+	out, err := newObjectWriter(ctx, cfg, outputFormat, outputPath)
+	if err != nil {
+		log.Fatalln("error:", err)
+	}
+	if len(teePaths) > 0 {
+		writers := multiWriter{out}
+		for _, path := range teePaths {
+			tee, err := openTee(ctx, cfg, path)
+			if err != nil {
+				log.Fatalln("error: -tee:", err)
+			}
+			writers = append(writers, tee)
+		}
+		out = writers
+	}
+	// The database is written like the outputs, with the keys redacted.
+	if sqlitePath != "" {
+		out, err = newSQLiteWriter(sqlitePath, out)
+		if err != nil {
+			log.Fatalln("error: -sqlite:", err)
+		}
+	}
+	// The manifest is for Batch Operations jobs, so it keeps the real keys.
+	if keyRedactor != nil {
+		out = &redactWriter{w: out, r: keyRedactor}
+	}
+	if len(keyTransforms) > 0 {
+		out = transformWriter{out, keyTransforms}
+	}
+	if normalizeKeys {
+		out = normalizeWriter{out}
+	}
+	if manifestPath != "" {
+		out, err = newManifestWriter(manifestPath, out)
+		if err != nil {
+			log.Fatalln("error:", err)
+		}
+	}
+	if sortBy != "" {
+		out, err = newSortWriter(out, sortBy, limit)
+		if err != nil {
+			log.Fatalln("error:", err)
+		}
+	}
+	if latestPerPrefix {
+		out = newLatestWriter(out, latestGroup)
+	}
+	if expectTransitionStr != "" {
+		out = newLifecycleWriter(out, os.Stderr, types.StorageClass(expectClass))
+	}
+	var alert *alertWriter
+	if alertObjectSize >= 0 || alertTotalSize >= 0 {
+		alert = newAlertWriter(out)
+		out = alert
+	}
+	if warnDuplicateKeys {
+		out = newDuplicateVersionsWriter(out)
+	}
+	if findOrphans != "" {
+		expected, err := readExpectedKeys(ctx, cfg, findOrphans)
+		if err != nil {
+			fatalClientError(err)
+		}
+		out = newOrphanWriter(out, bucketName, prefixes, expected)
+	}
+	var diff *diffWriter
+	if sinceFile != "" || sinceInventory != "" {
+		diff, err = newDiffWriter(ctx, cfg, out)
+		if err != nil {
+			fatalClientError(err)
+		}
+		out = diff
+	}
+	out = &lockedWriter{w: out}
+
+	// Flush what was listed so far when interrupted.
+	onInterrupt(func() {
+		if err := out.Close(); err != nil {
+			log.Println("error:", err)
+		}
+		writeInterruptedReport()
+	})
+
+	// The buckets are listed concurrently, each into its own stats.
+	totals := make([]*stats, len(buckets))
+	listErr := forEach(len(buckets), func(i int) error {
+		totals[i] = newStats()
+		var err error
+		if inventory != nil {
+			err = listInventory(ctx, cfg, inventory, out, totals[i])
+		} else if otherBucket != "" {
+			err = compareBuckets(ctx, cfg, buckets[i], prefixes[0], out, totals[i])
+		} else {
+			err = listBucket(ctx, cfg, buckets[i], prefixes, out, totals[i])
+		}
+		// The listings stopped by -max-runtime are not failures to skip.
+		if ctx.Err() == nil && skipFailedListing(err) {
+			return nil
+		}
+		return err
+	})
+	if err := out.Close(); err != nil {
+		log.Fatalln("error:", err)
+	}
+	// The report is written even when the listing failed, to record what
+	// was deleted until then.
+	if deletions != nil && !dryRun {
+		if err := deletions.write(deleteReportPath); err != nil {
+			log.Fatalln("error: failed to write the deletion report:", err)
+		}
+	}
+	// A failed listing still prints the summaries of what was listed until
+	// then, its error is reported last.
+	timedOut := exceededMaxRuntime(listErr)
+	if diff != nil {
+		if timedOut {
+			log.Println("warning: not storing the snapshot of a partial listing (-max-runtime)")
+		} else if listErr != nil {
+			log.Println("warning: not storing the snapshot of a failed listing")
+		} else if maxKeys > 0 && keysExamined.Load() >= maxKeys {
+			log.Println("warning: not storing the snapshot of a partial listing (-max-keys)")
+		} else if failedListings.Load() > 0 {
+			log.Println("warning: not storing the snapshot of a partial listing (-continue-on-error)")
+		} else if err := diff.storeSnapshot(); err != nil {
+			fatalClientError(err)
+		}
+	}
+
+	total := newStats()
+	for _, t := range totals {
+		total.merge(t)
+	}
+
+	warnUnknownSizes()
+	if maxKeys > 0 && keysExamined.Load() >= maxKeys {
+		log.Printf("warning: stopped after examining %d keys (-max-keys), the results are partial", maxKeys)
+		if nextContinuationToken != "" {
+			log.Printf("next continuation token: %s", nextContinuationToken)
+		}
+	}
+
+	if metricsFile != "" {
+		if err := writeMetrics(metricsFile, total); err != nil {
+			log.Fatalln("error:", err)
+		}
+	}
+
+	if statsJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(newStatsRecord(total, time.Since(startTime))); err != nil {
+			log.Fatalln("error:", err)
+		}
+	}
+	if bench {
+		elapsed := time.Since(startTime)
+		listed := keysExamined.Load()
+		fmt.Printf("%d objects listed in %s, %.0f objects/s\n", listed, elapsed.Round(time.Millisecond), float64(listed)/elapsed.Seconds())
+	}
+	if compact {
+		fmt.Printf("%d objects, %s\n", total.count, byteCountIEC(total.size))
+	}
+	if printSummary {
+		if len(buckets) > 1 {
+			for i, bucket := range buckets {
+				fmt.Fprintf(os.Stderr, "%s: %d objects, %s\n", bucket, totals[i].count, byteCountIEC(totals[i].size))
+			}
+			fmt.Fprintf(os.Stderr, "%d buckets, ", len(buckets))
+		}
+		fmt.Fprintf(os.Stderr, "%d objects, %s\n", total.count, byteCountIEC(total.size))
+	}
+	if showPercentiles && !statsJSON {
+		printPercentiles(os.Stderr, total)
+	}
+	if listErr != nil {
+		if !timedOut {
+			log.Println("warning: the listing failed, the results are partial")
+		}
+		fatalClientError(listErr)
+	}
+	if alert != nil && alert.report() {
+		os.Exit(1)
+	}
+	if n := failedListings.Load(); n > 0 {
+		log.Fatalf("error: failed to list %d buckets or prefixes", n)
+	}
+	if n := skippedContentTypes.Load(); n > 0 {
+		log.Printf("warning: skipped %d objects whose content type could not be fetched (-content-type)", n)
+	}
+	if n := alreadyInClass.Load(); n > 0 && !quiet {
+		log.Printf("note: skipped %d objects already in %s", n, setStorageClass)
+	}
+	if n := failedUpdates.Load(); n > 0 {
+		log.Fatalf("error: failed to update %d objects", n)
+	}
+	if n := failedDeletes.Load(); n > 0 {
+		log.Fatalf("error: failed to delete %d versions", n)
+	}
+	if failOnEmpty && total.count == 0 {
+		log.Fatalln("error: no matching objects")
+	}
+	if expectMin >= 0 && total.count < expectMin {
+		log.Fatalf("error: expected at least %d matching objects, found %d", expectMin, total.count)
+	}
+	if expectMax >= 0 && total.count > expectMax {
+		log.Fatalf("error: expected at most %d matching objects, found %d", expectMax, total.count)
+	}
+	if failLarger >= 0 && total.size > failLarger {
+		log.Fatalf("error: the matched objects total %s (%d bytes), more than the %s allowed by -fail-if-larger-than", byteCountIEC(total.size), total.size, byteCountIEC(failLarger))
+	}
+}
+
+// onInterrupt calls flush when interrupted by SIGINT or SIGTERM, then exits
+// with the status of an interrupted command.
+func onInterrupt(flush func()) {
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted
+		flush()
+		os.Exit(130)
+	}()
+}
+
+// writeInterruptedReport writes the -delete-report of an interrupted
+// deletion, to record what was deleted until then.
+func writeInterruptedReport() {
+	if deletions != nil && !dryRun {
+		if err := deletions.write(deleteReportPath); err != nil {
+			log.Println("error: failed to write the deletion report:", err)
+		}
+	}
+}
+
+// targetDescription describes the buckets and prefix being listed.
+func targetDescription() string {
+	if bucketsMatching != "" {
+		return fmt.Sprintf("the buckets matching %q", bucketsMatching)
+	}
+	if fromInventory != "" {
+		return "the objects of the inventory " + fromInventory
+	}
+	if bucketName == "" {
+		return "the buckets of -bucket-regions"
+	}
+	if prefixFile != "" {
+		return fmt.Sprintf("the prefixes of %s in s3://%s", prefixFile, bucketName)
+	}
+	return fmt.Sprintf("s3://%s/%s", bucketName, bucketPrefix)
+}
+
+// forEach calls fn for each index below n, running up to -concurrency calls
+// at once, and returns the errors they returned.
+func forEach(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	lim := newLimiter()
+	for i := range n {
+		wg.Add(1)
+		lim.acquire()
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = fn(i)
+			lim.release(time.Since(start), errs[i])
+			if isSkipped(errs[i]) {
+				errs[i] = nil
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// failedListings counts the buckets and prefixes that failed to list with
+// -continue-on-error.
+var failedListings atomic.Int64
+
+// skipFailedListing logs and counts err with -continue-on-error, reporting
+// whether the listing should proceed with the next bucket or prefix.
+func skipFailedListing(err error) bool {
+	if err == nil || !continueOnError {
+		return false
+	}
+	log.Println("error:", err)
+	failedListings.Add(1)
+	return true
+}
+
+// maxRuntimeExitCode is the exit status when -max-runtime is exceeded, the
+// one of timeout(1).
+const maxRuntimeExitCode = 124
+
+// exceededMaxRuntime reports whether err is due to the run exceeding
+// -max-runtime, rather than to a -page-timeout.
+func exceededMaxRuntime(err error) bool {
+	return maxRuntime > 0 && errors.Is(err, context.DeadlineExceeded) && time.Since(startTime) >= maxRuntime
+}
+
+// exitMaxRuntime exits with maxRuntimeExitCode.
+func exitMaxRuntime() {
+	log.Printf("error: stopped after -max-runtime %s, the results are partial", maxRuntime)
+	os.Exit(maxRuntimeExitCode)
+}
+
+// fatalClientError exits with err, hinting at how to refresh the credentials
+// when they come from an expired SSO session, or with maxRuntimeExitCode when
+// the run exceeded -max-runtime.
+func fatalClientError(err error) {
+	if exceededMaxRuntime(err) {
+		exitMaxRuntime()
+	}
+	if isSSOExpired(err) {
+		log.Printf("hint: the SSO session has expired, run %q to refresh it", ssoLoginHint())
+	}
+	log.Fatalln("error:", err)
+}
+
+// listBucket lists each of the prefixes of bucket.
+func listBucket(ctx context.Context, cfg aws.Config, bucket string, prefixes []string, out objectWriter, total *stats) error {
+	client, err := newBucketClient(ctx, cfg, bucket)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bucket, err)
+	}
+	if expandPrefixGlob && hasGlob(bucketPrefix) {
+		prefixes, err = expandPrefix(ctx, client, bucket, bucketPrefix)
+		if err != nil {
+			return fmt.Errorf("%s: %w", bucket, err)
+		}
+	}
+	for _, prefix := range prefixes {
+		list := listObjects
+		if showVersions {
+			list = listVersions
+		}
+		if err := list(ctx, client, bucket, prefix, out, total); err != nil {
+			err = fmt.Errorf("%s: %w", bucket, err)
+			if skipFailedListing(err) {
+				continue
 			}
-			fmt.Printf("%9s ", byteCountIEC(size))
-			fmt.Printf("%s %s %s", obj.LastModified.Format(time.DateTime), obj.StorageClass, key)
-			if isTerm {
-				// Reset colors
-				fmt.Print("\033[0m")
+			return err
+		}
+	}
+	return nil
+}
+
+// listObjects lists the objects of bucket below prefix, writing the matched
+// ones to out and adding them to total.
+func listObjects(ctx context.Context, client *s3.Client, bucket, prefix string, out objectWriter, total *stats) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	if delimiter != "" {
+		input.Delimiter = &delimiter
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = &continuationToken
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+
+	// pageToken is the token the current page was listed from.
+	pageToken := continuationToken
+	for n := 1; paginator.HasMorePages(); n++ {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return err
+		}
+		if showPages {
+			logPage(bucket, prefix, n, len(page.Contents), len(page.CommonPrefixes), aws.ToBool(page.IsTruncated),
+				"continuation token "+aws.ToString(page.NextContinuationToken))
+		}
+		whole := keysExamined.Load()+int64(len(page.Contents)) <= maxKeys
+		for _, prefix := range page.CommonPrefixes {
+			if err := out.WritePrefix(bucket, *prefix.Prefix); err != nil {
+				return err
 			}
-			fmt.Println()
 		}
+		if onlyPrefixes {
+			continue
+		}
+		budgetExhausted, err := processObjects(ctx, client, bucketObjects(bucket, page.Contents), out, total)
+		if err != nil {
+			return err
+		}
+		if budgetExhausted {
+			// The tokens only resume at page boundaries, so a page examined
+			// in part is listed again in full.
+			if !singleListing() {
+				break
+			}
+			if !whole {
+				nextContinuationToken = pageToken
+			} else if page.NextContinuationToken != nil {
+				nextContinuationToken = *page.NextContinuationToken
+			}
+			break
+		}
+		pageToken = aws.ToString(page.NextContinuationToken)
+	}
+	return nil
+}
+
+// singleListing reports whether a single prefix of a single bucket is
+// listed, the only listing a continuation token can resume.
+func singleListing() bool {
+	return bucketName != "" && prefixFile == "" && !(expandPrefixGlob && hasGlob(bucketPrefix))
+}
+
+// bucketObjects returns the listed contents of bucket as objects.
+func bucketObjects(bucket string, contents []types.Object) []object {
+	objs := make([]object, len(contents))
+	for i, obj := range contents {
+		objs[i] = object{Object: obj, bucket: bucket}
+	}
+	return objs
+}
+
+// processObjects writes the contents passing the filters to out and adds them
+// to total, running the enrichers on them first. It reports whether the
+// -max-keys budget is exhausted.
+func processObjects(ctx context.Context, client *s3.Client, contents []object, out objectWriter, total *stats) (bool, error) {
+	n := int64(len(contents))
+	contents, examined, budgetExhausted := examineKeys(contents)
+	var objs []object
+	for _, obj := range contents {
+		if matchObject(obj.bucket, obj.Object) {
+			objs = append(objs, obj)
+		}
+	}
+	err := enrichObjects(ctx, client, objs, func(obj object) error {
+		if err := out.Write(obj); err != nil {
+			return err
+		}
+		total.addObject(obj.Object)
+		matchedObjects.Add(1)
+		matchedBytes.Add(*obj.Size)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	logProgress(examined, n)
+	return budgetExhausted, nil
+}
+
+// examineKeys counts contents in keysExamined and returns the objects within
+// the -max-keys budget, the keys examined so far, and whether the budget is
+// exhausted.
+func examineKeys[T any](contents []T) ([]T, int64, bool) {
+	n := int64(len(contents))
+	after := keysExamined.Add(n)
+	if maxKeys <= 0 || after < maxKeys {
+		return contents, after, false
+	}
+	keep := max(n-(after-maxKeys), 0)
+	return contents[:keep], after, true
+}
+
+// logProgress logs a -progress-every line when the last n keys examined,
+// bringing the total to examined, crossed a multiple of -progress-every.
+func logProgress(examined, n int64) {
+	if progressEvery <= 0 || (examined-n)/progressEvery == examined/progressEvery {
+		return
+	}
+	elapsed := time.Since(startTime)
+	line := fmt.Sprintf("progress: %d keys examined, %d matched (%s), %s elapsed",
+		examined, matchedObjects.Load(), byteCountIEC(matchedBytes.Load()), elapsed.Round(time.Second))
+	if deletesVersions() && !dryRun {
+		line += deletionProgress(deletedVersions.Load(), deleteEstimate, elapsed)
+	}
+	log.Print(line)
+}
+
+// logPage logs the -show-pages line of the nth page of the listing of bucket
+// below prefix, holding keys keys and prefixes common prefixes. The next
+// page, when truncated, is listed from cursor.
+func logPage(bucket, prefix string, n, keys, prefixes int, truncated bool, cursor string) {
+	line := fmt.Sprintf("page %d of s3://%s/%s: %d keys, %d prefixes", n, bucket, prefix, keys, prefixes)
+	if truncated {
+		line += ", truncated, next " + cursor
+	} else {
+		line += ", last"
+	}
+	log.Print(line)
+}
+
+// deletionProgress describes the deletions of a progress line: the versions
+// deleted out of the total when known, and the time left at the current rate.
+func deletionProgress(deleted, total int64, elapsed time.Duration) string {
+	if total <= 0 {
+		return fmt.Sprintf(", %d deleted", deleted)
+	}
+	s := fmt.Sprintf(", %d/%d deleted", deleted, total)
+	if deleted > 0 && deleted < total {
+		rate := float64(deleted) / elapsed.Seconds()
+		eta := time.Duration(float64(total-deleted) / rate * float64(time.Second))
+		s += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return s
+}
+
+// pager is implemented by the SDK paginators.
+type pager[T any] interface {
+	NextPage(ctx context.Context, optFns ...func(*s3.Options)) (T, error)
+}
+
+// nextPage fetches the next page of p. When -page-timeout is set, each
+// attempt is bounded by it and timed out attempts are retried up to
+// -page-retries times.
+func nextPage[T any](ctx context.Context, p pager[T]) (T, error) {
+	if pageTimeout == 0 {
+		return p.NextPage(ctx)
+	}
+	for attempt := 0; ; attempt++ {
+		pageCtx, cancel := context.WithTimeout(ctx, pageTimeout)
+		page, err := p.NextPage(pageCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+			return page, err
+		}
+		if attempt >= pageRetries {
+			return page, fmt.Errorf("page request timed out after %s: %w", pageTimeout, err)
+		}
+		log.Printf("warning: page request timed out after %s, retrying", pageTimeout)
+	}
+}
+
+// matchObject reports whether obj of bucket passes the key and size filters.
+func matchObject(bucket string, obj types.Object) bool {
+	matched := *obj.Key
+	if filterURI {
+		matched = "s3://" + bucket + "/" + matched
+	}
+	if !strings.Contains(matched, filter) {
+		return false
+	}
+	// The versions listed without a size are matched as empty, like
+	// fillSizes counts them, in the previews that do not fill them.
+	size := aws.ToInt64(obj.Size)
+	if (minSize != 0 && size < minSize) || (maxSize != 0 && size > maxSize) {
+		return false
+	}
+	if sizeEqual >= 0 && size != sizeEqual {
+		return false
+	}
+	if pathSegment != "" && !slices.Contains(strings.Split(*obj.Key, "/"), pathSegment) {
+		return false
+	}
+	if keyDepth != 0 || minKeyDepth != 0 || maxKeyDepth != 0 {
+		depth := depthBelowPrefix(*obj.Key)
+		if (keyDepth != 0 && depth != keyDepth) || (minKeyDepth != 0 && depth < minKeyDepth) || (maxKeyDepth != 0 && depth > maxKeyDepth) {
+			return false
+		}
+	}
+	age := startTime.Sub(*obj.LastModified)
+	if (minAge != 0 && age < minAge) || (maxAge != 0 && age > maxAge) {
+		return false
+	}
+	if hoursStr != "" && !inHours(obj.LastModified.In(location).Hour(), hoursStart, hoursEnd) {
+		return false
+	}
+	// HeadObject only gives the reference time to the second.
+	if !newerThan.IsZero() && !obj.LastModified.Truncate(time.Second).After(newerThan) {
+		return false
+	}
+	if expectTransitionStr != "" && !lateForTransition(obj) {
+		return false
+	}
+	if exprProgram != nil {
+		matched, err := matchExpr(exprProgram, bucket, obj)
+		if err != nil {
+			log.Fatalf("error: -expr on %s: %v", printedKey(*obj.Key), err)
+		}
+		return matched
+	}
+	return true
+}
+
+// depthBelowPrefix returns the number of path segments of key below -prefix:
+// logs/app/file is 2 segments deep below logs/.
+func depthBelowPrefix(key string) int {
+	return strings.Count(strings.TrimPrefix(key, bucketPrefix), "/") + 1
+}
+
+// referenceTime returns the modification time of the -newer-than-object
+// reference, a key of -bucket or an s3:// URI.
+func referenceTime(ctx context.Context, cfg aws.Config, ref string) (time.Time, error) {
+	bucket, key := bucketName, ref
+	if strings.HasPrefix(ref, "s3://") {
+		var err error
+		if bucket, key, err = parseS3URI(ref); err != nil {
+			return time.Time{}, err
+		}
+	} else if bucket == "" {
+		return time.Time{}, fmt.Errorf("%q is not an s3:// URI and -bucket is not set", ref)
+	}
+	client, err := newBucketClient(ctx, cfg, bucket)
+	if err != nil {
+		return time.Time{}, err
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+	if isAPIError(err, "NotFound") {
+		return time.Time{}, fmt.Errorf("the reference object s3://%s/%s does not exist", bucket, key)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the reference object s3://%s/%s: %w", bucket, key, err)
+	}
+	return aws.ToTime(head.LastModified), nil
+}
+
+// parseHours parses an hour range such as 9-17, from the start hour included
+// to the end hour excluded.
+func parseHours(s string) (int, int, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected START-END, got %q", s)
+	}
+	startHour, err1 := strconv.Atoi(start)
+	endHour, err2 := strconv.Atoi(end)
+	if err1 != nil || err2 != nil || startHour < 0 || startHour > 23 || endHour < 0 || endHour > 24 || startHour == endHour {
+		return 0, 0, fmt.Errorf("expected hours between 0 and 24, got %q", s)
+	}
+	return startHour, endHour, nil
+}
+
+// inHours reports whether hour is in the range from start to end, which
+// wraps around midnight when end is before start, as in 22-6.
+func inHours(hour, start, end int) bool {
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// parseAge parses a duration like time.ParseDuration, also accepting a
+// number of days or weeks such as 7d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			days, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(days * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// mustParseAge is like parseAge but exits on error, naming the flag.
+func mustParseAge(name, s string) time.Duration {
+	d, err := parseAge(s)
+	if err != nil {
+		log.Fatalf("error: invalid %s: %v", name, err)
+	}
+	return d
+}
+
+// displayKey returns key as it should be printed: as an s3:// URI with
+// -full, or relative to -prefix with -relative, and without -strip-prefix
+// and -strip-suffix.
+func displayKey(bucket, key string) string {
+	if relativeKeys && !printFullObjectPath {
+		key = strings.TrimPrefix(key, bucketPrefix)
+	}
+	key = strings.TrimSuffix(strings.TrimPrefix(key, stripPrefix), stripSuffix)
+	if printFullObjectPath {
+		return fmt.Sprintf("s3://%s/%s", bucket, key)
+	}
+	return key
+}
+
+// humanizeAge returns how long ago t was, using the largest unit that fits.
+func humanizeAge(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < 0:
+		return "in the future"
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 60*24*time.Hour:
+		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+	case d < 2*365*24*time.Hour:
+		return fmt.Sprintf("%d months ago", int(d.Hours()/24/30))
+	default:
+		return fmt.Sprintf("%d years ago", int(d.Hours()/24/365))
 	}
 }
 
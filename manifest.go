@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// manifestWriter writes the objects to a CSV manifest in the bucket,key
+// format expected by S3 Batch Operations, and passes them on to next. The
+// versions listed with -versions are written as bucket,key,version_id rows,
+// which the jobs read as these versions rather than the current ones.
+type manifestWriter struct {
+	next objectWriter
+	f    *os.File
+	csv  *csv.Writer
+}
+
+func newManifestWriter(path string, next objectWriter) (*manifestWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestWriter{next: next, f: f, csv: csv.NewWriter(f)}, nil
+}
+
+func (m *manifestWriter) Write(obj object) error {
+	row := []string{obj.bucket, manifestKey(*obj.Key)}
+	if obj.versionID != "" {
+		row = append(row, obj.versionID)
+	}
+	if err := m.csv.Write(row); err != nil {
+		return err
+	}
+	return m.next.Write(obj)
+}
+
+func (m *manifestWriter) WritePrefix(bucket, prefix string) error {
+	return m.next.WritePrefix(bucket, prefix)
+}
+
+func (m *manifestWriter) Close() error {
+	m.csv.Flush()
+	if err := m.csv.Error(); err != nil {
+		m.f.Close()
+		return err
+	}
+	if err := m.f.Close(); err != nil {
+		return err
+	}
+	return m.next.Close()
+}
+
+// manifestKey URL-encodes key as S3 Batch Operations expects, keeping the
+// slashes between the segments. PathEscape keeps "+", which would be decoded
+// as a space, so it is escaped as well.
+func manifestKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
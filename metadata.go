@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/term"
+)
+
+// maxCopySize is the largest object CopyObject can copy in a single request.
+const maxCopySize int64 = 5 * 1024 * 1024 * 1024
+
+// metadataFlag collects the repeated -set-metadata key=value flags.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[strings.ToLower(k)] = v
+	return nil
+}
+
+// rewritesMetadata reports whether a metadata or storage class update was
+// requested.
+func rewritesMetadata() bool {
+	return setContentType != "" || len(setMetadata) > 0 || setStorageClass != ""
+}
+
+// transitionsOnly reports whether the update only changes the storage class.
+func transitionsOnly() bool {
+	return setStorageClass != "" && setContentType == "" && len(setMetadata) == 0
+}
+
+// modifiesObjects reports whether the objects will actually be modified, as
+// opposed to only listed or previewed with -dry-run.
+func modifiesObjects() bool {
+	return (rewritesMetadata() || deletesVersions() || abortIncomplete) && !dryRun
+}
+
+var (
+	// failedUpdates counts the objects that could not be updated.
+	failedUpdates atomic.Int64
+	// alreadyInClass counts the objects -set-storage-class skipped.
+	alreadyInClass atomic.Int64
+)
+
+// updateMetadata is the enricher copying obj onto itself with the
+// -set-content-type, -set-metadata and -set-storage-class changes. Objects
+// failing to update are logged and counted in failedUpdates, and their errors
+// skipped rather than stopping the listing.
+func updateMetadata(ctx context.Context, client *s3.Client, obj *object) error {
+	// The listings leave the storage class of STANDARD objects empty.
+	if transitionsOnly() && (string(obj.StorageClass) == setStorageClass || obj.StorageClass == "" && setStorageClass == string(types.StorageClassStandard)) {
+		alreadyInClass.Add(1)
+		return nil
+	}
+	if err := copyWithMetadata(ctx, client, obj.bucket, *obj.Key); err != nil {
+		log.Printf("error: failed to update s3://%s/%s: %v", obj.bucket, printedKey(*obj.Key), err)
+		failedUpdates.Add(1)
+		return skippedError{err}
+	}
+	return nil
+}
+
+// copyWithMetadata copies the object onto itself, replacing its metadata.
+// REPLACE drops every header that is not sent again, so the current headers,
+// storage class and encryption are fetched first and carried over.
+func copyWithMetadata(ctx context.Context, client *s3.Client, bucket, key string) error {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return err
+	}
+	if *head.ContentLength > maxCopySize {
+		return fmt.Errorf("objects larger than %s cannot be copied in place", byteCountIEC(maxCopySize))
+	}
+
+	metadata := head.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	for k, v := range setMetadata {
+		metadata[k] = v
+	}
+	contentType := head.ContentType
+	if setContentType != "" {
+		contentType = &setContentType
+	}
+	storageClass := types.StorageClass(head.StorageClass)
+	if setStorageClass != "" {
+		storageClass = types.StorageClass(setStorageClass)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:             &bucket,
+		Key:                &key,
+		CopySource:         aws.String(bucket + "/" + url.PathEscape(key)),
+		CopySourceIfMatch:  head.ETag,
+		MetadataDirective:  types.MetadataDirectiveReplace,
+		Metadata:           metadata,
+		ContentType:        contentType,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		ContentEncoding:    head.ContentEncoding,
+		ContentLanguage:    head.ContentLanguage,
+		Expires:            head.Expires,
+		StorageClass:       storageClass,
+	}
+	// The copy would otherwise get the default encryption of the bucket.
+	// AES256 has no key, the KMS ones, aws:kms and aws:kms:dsse, keep theirs.
+	input.ServerSideEncryption = head.ServerSideEncryption
+	if head.ServerSideEncryption != "" && head.ServerSideEncryption != types.ServerSideEncryptionAes256 {
+		input.SSEKMSKeyId = head.SSEKMSKeyId
+		input.BucketKeyEnabled = head.BucketKeyEnabled
+	}
+	_, err = client.CopyObject(ctx, input)
+	return err
+}
+
+// previewMatches counts the objects matching the filters in the first page
+// of each prefix of buckets, or the versions with -versions, and reports
+// whether that covers every listed key.
+func previewMatches(ctx context.Context, cfg aws.Config, buckets, prefixes []string) (usage, bool, error) {
+	var preview usage
+	exact := true
+	for _, bucket := range buckets {
+		client, err := newBucketClient(ctx, cfg, bucket)
+		if err != nil {
+			return preview, false, err
+		}
+		for _, prefix := range prefixes {
+			objs, truncated, err := firstPage(ctx, client, bucket, prefix)
+			if err != nil {
+				return preview, false, fmt.Errorf("%s: %w", bucket, err)
+			}
+			for _, obj := range objs {
+				if matchObject(bucket, obj.Object) {
+					preview.add(usage{count: 1, size: aws.ToInt64(obj.Size)})
+				}
+			}
+			exact = exact && !truncated
+		}
+	}
+	return preview, exact, nil
+}
+
+// firstPage lists the first page of objects of bucket below prefix, or of
+// versions that -delete-versions-older-than may delete with -versions, and
+// reports whether there are more.
+func firstPage(ctx context.Context, client *s3.Client, bucket, prefix string) ([]object, bool, error) {
+	if !showVersions {
+		page, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: &bucket,
+			Prefix: &prefix,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return bucketObjects(bucket, page.Contents), aws.ToBool(page.IsTruncated), nil
+	}
+	page, err := client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	objs := make([]object, len(page.Versions))
+	for i, v := range page.Versions {
+		objs[i] = versionObject(bucket, v)
+	}
+	if deletesVersions() {
+		objs = deletableVersions(objs)
+	}
+	return objs, aws.ToBool(page.IsTruncated), nil
+}
+
+// describePreview describes the preview count of objects, as a lower bound
+// when it is not exact.
+func describePreview(preview usage, exact bool, noun string) string {
+	if preview.count == 1 {
+		noun = strings.TrimSuffix(noun, "s")
+	}
+	if exact {
+		return fmt.Sprintf("%s %s (%s)", formatCount(preview.count), noun, byteCountIEC(preview.size))
+	}
+	return fmt.Sprintf("at least %s %s (at least %s)", formatCount(preview.count), noun, byteCountIEC(preview.size))
+}
+
+// formatCount formats n with thousands separators, such as 12,345.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// confirm asks the user to confirm prompt on the terminal, unless -yes is
+// set. It refuses to proceed when stdin is not a terminal.
+func confirm(prompt string) bool {
+	if assumeYes {
+		return true
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Fatalln("error: stdin is not a terminal, use -yes to confirm")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// writeMetrics writes total in the Prometheus text format to path, for the
+// node-exporter textfile collector. The file is written to a temporary file
+// first and then renamed, so the collector never reads a partial file.
+func writeMetrics(path string, total *stats) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	bucket := bucketName
+	if bucketsMatching != "" {
+		// The metrics aggregate every matching bucket.
+		bucket = bucketsMatching
+	}
+	labels := fmt.Sprintf(`bucket="%s",prefix="%s"`, escapeLabel(bucket), escapeLabel(bucketPrefix))
+
+	writeMetricHeader(w, "lsb_objects", "Number of matched objects.")
+	fmt.Fprintf(w, "lsb_objects{%s} %d\n", labels, total.count)
+	writeMetricHeader(w, "lsb_bytes", "Total size in bytes of the matched objects.")
+	fmt.Fprintf(w, "lsb_bytes{%s} %d\n", labels, total.size)
+
+	classes := total.sortedClasses()
+	writeMetricHeader(w, "lsb_storage_class_objects", "Number of matched objects per storage class.")
+	for _, class := range classes {
+		fmt.Fprintf(w, "lsb_storage_class_objects{%s,storage_class=\"%s\"} %d\n", labels, escapeLabel(class), total.classes[class].count)
+	}
+	writeMetricHeader(w, "lsb_storage_class_bytes", "Total size in bytes of the matched objects per storage class.")
+	for _, class := range classes {
+		fmt.Fprintf(w, "lsb_storage_class_bytes{%s,storage_class=\"%s\"} %d\n", labels, escapeLabel(class), total.classes[class].size)
+	}
+
+	writeMetricHeader(w, "lsb_last_run_timestamp_seconds", "Unix time of the end of the listing.")
+	fmt.Fprintf(w, "lsb_last_run_timestamp_seconds{%s} %d\n", labels, time.Now().Unix())
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file as 0600, which the collector may not be
+	// allowed to read.
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// incompleteUpload is a multipart upload that was initiated but never
+// completed or aborted.
+type incompleteUpload struct {
+	bucket    string
+	key       string
+	uploadID  string
+	initiated time.Time
+}
+
+// listIncompleteUploads returns the incomplete multipart uploads of bucket
+// below prefix, keeping those matching the key filters, initiated within
+// -min-age and -max-age.
+func listIncompleteUploads(ctx context.Context, client *s3.Client, bucket, prefix string) ([]incompleteUpload, error) {
+	var uploads []incompleteUpload
+	input := &s3.ListMultipartUploadsInput{Bucket: &bucket, Prefix: &prefix}
+	for {
+		page, err := client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bucket, err)
+		}
+		for _, u := range page.Uploads {
+			if matchUpload(bucket, u) {
+				uploads = append(uploads, incompleteUpload{
+					bucket:    bucket,
+					key:       aws.ToString(u.Key),
+					uploadID:  aws.ToString(u.UploadId),
+					initiated: aws.ToTime(u.Initiated),
+				})
+			}
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			return uploads, nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.UploadIdMarker = page.NextUploadIdMarker
+	}
+}
+
+// matchUpload reports whether u matches the filters of the objects, its
+// initiation time standing for the modification time. The uploads have no
+// size, so the size filters and -expr are rejected with them.
+func matchUpload(bucket string, u types.MultipartUpload) bool {
+	return matchObject(bucket, types.Object{Key: u.Key, Size: aws.Int64(0), LastModified: u.Initiated})
+}
+
+// printIncompleteUploads prints the initiation time, key and upload ID of
+// each upload.
+func printIncompleteUploads(w io.Writer, uploads []incompleteUpload) {
+	for _, u := range uploads {
+		fmt.Fprintf(w, "%s %s (upload %s)\n", u.initiated.Format("2006-01-02 15:04:05"), displayKey(u.bucket, printedKey(u.key)), u.uploadID)
+	}
+}
+
+// abortIncompleteUploads aborts uploads, running up to -concurrency requests
+// at once. The uploads failing to abort are logged, and their count is
+// returned.
+func abortIncompleteUploads(ctx context.Context, cfg aws.Config, uploads []incompleteUpload) (int64, error) {
+	clients := map[string]*s3.Client{}
+	for _, u := range uploads {
+		if _, ok := clients[u.bucket]; !ok {
+			client, err := newBucketClient(ctx, cfg, u.bucket)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", u.bucket, err)
+			}
+			clients[u.bucket] = client
+		}
+	}
+	var failed atomic.Int64
+	err := forEach(len(uploads), func(i int) error {
+		u := uploads[i]
+		_, err := clients[u.bucket].AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &u.bucket,
+			Key:      &u.key,
+			UploadId: &u.uploadID,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("error: failed to abort the upload %s of s3://%s/%s: %v", u.uploadID, u.bucket, printedKey(u.key), err)
+			failed.Add(1)
+			return skippedError{err}
+		}
+		return nil
+	})
+	return failed.Load(), err
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeWriter writes the objects to w with their keys in Unicode
+// Normalization Form C, so that a key written with combining characters
+// displays like its precomposed form. The keys are only normalized for
+// display: the objects are matched and fetched with their real keys.
+type normalizeWriter struct {
+	w objectWriter
+}
+
+func (n normalizeWriter) Write(obj object) error {
+	obj.Key = aws.String(norm.NFC.String(*obj.Key))
+	return n.w.Write(obj)
+}
+
+func (n normalizeWriter) WritePrefix(bucket, prefix string) error {
+	return n.w.WritePrefix(bucket, norm.NFC.String(prefix))
+}
+
+func (n normalizeWriter) Close() error {
+	return n.w.Close()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// readExpectedKeys reads the keys expected by -find-orphans: from the S3
+// Inventory manifest.json at an s3:// path, from a CSV manifest of bucket and
+// URL-encoded key rows like the -manifest ones, or from a newline-delimited
+// list of keys.
+func readExpectedKeys(ctx context.Context, cfg aws.Config, path string) (map[string]bool, error) {
+	keys := map[string]bool{}
+	if strings.HasPrefix(path, "s3://") {
+		manifest, err := readInventoryManifest(ctx, cfg, path)
+		if err != nil {
+			return nil, err
+		}
+		err = readInventory(ctx, cfg, manifest, func(obj types.Object) error {
+			keys[*obj.Key] = true
+			return nil
+		})
+		return keys, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".csv") {
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		for {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				return keys, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(record) < 2 {
+				return nil, fmt.Errorf("expected bucket,key rows, got %q", strings.Join(record, ","))
+			}
+			key, err := url.QueryUnescape(record[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %w", record[1], err)
+			}
+			keys[key] = true
+		}
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// orphanWriter writes to w the listed objects missing from the expected keys,
+// as orphans, then when closed the expected keys that were not listed, as
+// missing. Only the expected keys below the listed prefixes and containing
+// -filter can be missing.
+type orphanWriter struct {
+	w        objectWriter
+	bucket   string
+	prefixes []string
+	expected map[string]bool
+	seen     map[string]bool
+}
+
+func newOrphanWriter(w objectWriter, bucket string, prefixes []string, expected map[string]bool) *orphanWriter {
+	return &orphanWriter{w: w, bucket: bucket, prefixes: prefixes, expected: expected, seen: map[string]bool{}}
+}
+
+func (o *orphanWriter) Write(obj object) error {
+	o.seen[*obj.Key] = true
+	if o.expected[*obj.Key] {
+		return nil
+	}
+	obj.change = changeOrphan
+	return o.w.Write(obj)
+}
+
+// WritePrefix drops the common prefixes, only keys are compared.
+func (o *orphanWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (o *orphanWriter) Close() error {
+	var missing []object
+	for key := range o.expected {
+		if o.seen[key] || !strings.Contains(key, filter) || !o.listed(key) {
+			continue
+		}
+		obj := object{bucket: o.bucket, change: changeMissing}
+		obj.Key = aws.String(key)
+		obj.Size = aws.Int64(0)
+		obj.LastModified = &time.Time{}
+		missing = append(missing, obj)
+	}
+	slices.SortFunc(missing, objectOrders["key"])
+	for _, obj := range missing {
+		if err := o.w.Write(obj); err != nil {
+			return err
+		}
+	}
+	return o.w.Close()
+}
+
+// listed reports whether key is below one of the listed prefixes.
+func (o *orphanWriter) listed(key string) bool {
+	for _, prefix := range o.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
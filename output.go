@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+	"golang.org/x/term"
+)
+
+// object is a listed object along with the details fetched for it.
+type object struct {
+	types.Object
+	bucket string
+	lock   *lockStatus
+
+	// encryption is set with -show-encryption.
+	encryption *encryptionStatus
+
+	// versionID and isLatest are set for the versions listed with -versions.
+	versionID string
+	isLatest  bool
+
+	// content is the content fetched with -cat, unless it was skipped for
+	// catSkipped.
+	content    []byte
+	catSkipped string
+
+	// change is how the object changed with -since-file and
+	// -since-inventory-diff.
+	change string
+
+	// contentType is fetched with -content-type, which sets excluded for
+	// the objects it filters out.
+	contentType string
+	excluded    bool
+}
+
+// objectWriter renders the matched objects in a given output format.
+type objectWriter interface {
+	Write(obj object) error
+	WritePrefix(bucket, prefix string) error
+	Close() error
+}
+
+// newObjectWriter returns a writer for format, writing to path or to stdout
+// when path is empty. Nothing is opened when only the totals are printed.
+func newObjectWriter(ctx context.Context, cfg aws.Config, format, path string) (objectWriter, error) {
+	if statsJSON || compact || bench {
+		return discardWriter{}, nil
+	}
+	w, err := openOutput(ctx, cfg, path, contentTypes[format])
+	if err != nil {
+		return nil, err
+	}
+	if catContent {
+		return &catWriter{w: w}, nil
+	}
+	if estimateRestore {
+		return newRestoreCostWriter(w), nil
+	}
+	if smallObjectsStr != "" {
+		return newSmallObjectsWriter(w, smallObjects), nil
+	}
+	if treeSep != "" {
+		return newTreeWriter(w, treeSep), nil
+	}
+	if formatTemplate != nil {
+		return newTemplateWriter(w, formatTemplate), nil
+	}
+	if timeline != "" {
+		return newTimelineWriter(w, timeline)
+	}
+	if depthSummary {
+		return &depthWriter{w: w, depths: map[int]*usage{}}, nil
+	}
+	if groupBy != "" {
+		return newGroupWriter(w, groupBy, format == "json")
+	}
+	if dedupeByETag {
+		return newDedupeWriter(w), nil
+	}
+	return newFormatWriter(w, format, path, useColor(path))
+}
+
+// newFormatWriter returns the writer of the objects in format to w, opened
+// at path, the text being colorized when isTerm is set.
+func newFormatWriter(w *output, format, path string, isTerm bool) (objectWriter, error) {
+	switch format {
+	case "text":
+		return &textWriter{w: w, isTerm: isTerm, band: showBand && isTerm, percent: showPercent, sizeWidth: sizeWidth, columns: columns}, nil
+	case "csv", "tsv":
+		comma := ','
+		if format == "tsv" {
+			comma = '\t'
+		}
+		cols := columns
+		if len(cols) == 0 {
+			cols = defaultCSVColumns
+		}
+		c := newCSVWriter(w, comma, cols)
+		// The file appended to already starts with the header.
+		c.header = w.appended
+		return c, nil
+	case "json", "ndjson":
+		if query != nil {
+			return newQueryWriter(w, query, format == "ndjson"), nil
+		}
+		return newJSONWriter(w, format == "ndjson"), nil
+	case "parquet":
+		if path == "" {
+			return nil, fmt.Errorf("-output parquet requires -o")
+		}
+		return newParquetWriter(w), nil
+	case "html":
+		return newTemplateWriter(w, htmlReport), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// extensionFormats are the formats of the -tee files by extension.
+var extensionFormats = map[string]string{
+	".csv":     "csv",
+	".tsv":     "tsv",
+	".json":    "json",
+	".ndjson":  "ndjson",
+	".jsonl":   "ndjson",
+	".parquet": "parquet",
+	".html":    "html",
+	".htm":     "html",
+}
+
+// openTee returns the writer of the -tee file or s3://bucket/key URI at path,
+// in the format of its extension, else as text. The text is never colorized,
+// even with -color always, which is for the terminal output.
+func openTee(ctx context.Context, cfg aws.Config, path string) (objectWriter, error) {
+	format := cmp.Or(extensionFormats[strings.ToLower(filepath.Ext(path))], "text")
+	w, err := openOutput(ctx, cfg, path, contentTypes[format])
+	if err != nil {
+		return nil, err
+	}
+	return newFormatWriter(w, format, path, false)
+}
+
+// multiWriter writes the objects to each of its writers, the output and the
+// -tee files, so that a single listing produces all of them.
+type multiWriter []objectWriter
+
+func (m multiWriter) Write(obj object) error {
+	for _, w := range m {
+		if err := w.Write(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) WritePrefix(bucket, prefix string) error {
+	for _, w := range m {
+		if err := w.WritePrefix(bucket, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every writer, even when one of them fails.
+func (m multiWriter) Close() error {
+	errs := make([]error, len(m))
+	for i, w := range m {
+		errs[i] = w.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// useColor reports whether the output written to path should be colorized
+// according to -color. In auto mode, only a terminal stdout is colorized, and
+// only if NO_COLOR is not set.
+func useColor(path string) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return path == "" && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+type textWriter struct {
+	w         io.WriteCloser
+	isTerm    bool
+	sizeWidth int
+
+	// band buffers the objects to draw a size bar relative to the largest.
+	band    bool
+	objs    []object
+	maxSize int64
+
+	// percent buffers the objects to print their share of the matched bytes,
+	// only known once the listing is done.
+	percent bool
+
+	// columns are the -columns to print instead of the default layout.
+	columns []string
+}
+
+func (t *textWriter) Write(obj object) error {
+	if t.band || t.percent {
+		t.objs = append(t.objs, obj)
+		t.maxSize = max(t.maxSize, *obj.Size)
+		return nil
+	}
+	return t.print(obj)
+}
+
+func (t *textWriter) print(obj object) error {
+	size := *obj.Size
+	if obj.change != "" {
+		fmt.Fprintf(t.w, "%c ", changeMarkers[obj.change])
+	}
+	if obj.change == changeMissing {
+		// Missing objects have neither size nor date, like common prefixes.
+		return t.printLabeled("MISSING", obj.bucket, *obj.Key)
+	}
+	if t.isTerm {
+		fmt.Fprint(t.w, objectColor(obj))
+	}
+	if len(t.columns) > 0 {
+		values := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			values[i] = t.textColumn(obj, column)
+		}
+		fmt.Fprint(t.w, strings.Join(values, " "))
+		return t.endLine(obj)
+	}
+	fmt.Fprintf(t.w, "%*s ", t.sizeWidth, byteCountIEC(size))
+	if t.band {
+		fmt.Fprintf(t.w, "%-*s ", bandWidth, sizeBar(size, t.maxSize))
+	}
+	if t.percent {
+		share := 0.0
+		if total := matchedBytes.Load(); total > 0 {
+			share = float64(size) / float64(total) * 100
+		}
+		fmt.Fprintf(t.w, "%6.2f%% ", share)
+	}
+	modified := obj.LastModified.Format(time.DateTime)
+	if relativeTime {
+		modified = fmt.Sprintf("%*s", len(time.DateTime), humanizeAge(*obj.LastModified, time.Now()))
+	}
+	fmt.Fprintf(t.w, "%s ", modified)
+	if !noStorageClass {
+		fmt.Fprintf(t.w, "%s ", obj.StorageClass)
+	}
+	key := displayKey(obj.bucket, *obj.Key)
+	if t.isTerm {
+		key = highlightFilter(key, objectColor(obj))
+	}
+	fmt.Fprint(t.w, key)
+	if obj.versionID != "" {
+		latest := ""
+		if obj.isLatest {
+			latest = ", latest"
+		}
+		fmt.Fprintf(t.w, " (version %s%s)", obj.versionID, latest)
+	}
+	return t.endLine(obj)
+}
+
+// endLine ends the line of obj, after its lock status with -locks.
+func (t *textWriter) endLine(obj object) error {
+	if obj.lock != nil {
+		fmt.Fprintf(t.w, " (%s)", obj.lock)
+	}
+	if obj.encryption != nil {
+		fmt.Fprintf(t.w, " (%s)", obj.encryption)
+	}
+	if t.isTerm {
+		// Reset colors
+		fmt.Fprint(t.w, "\033[0m")
+	}
+	_, err := fmt.Fprintln(t.w)
+	return err
+}
+
+// highlightFilter highlights in bold and underlined the occurrences of
+// -filter in key, printed in color, like grep --color.
+func highlightFilter(key string, color Color) string {
+	if filter == "" {
+		return key
+	}
+	return strings.ReplaceAll(key, filter, "\033[1;4m"+filter+"\033[0m"+color.String())
+}
+
+// objectColor returns the color of obj according to -color-by: from white
+// to red as it grows, or from green to red as it ages.
+func objectColor(obj object) Color {
+	darkRed := Color{220, 0, 0}
+	if colorBy == "age" {
+		green := Color{0, 200, 0}
+		age := startTime.Sub(*obj.LastModified)
+		if age <= colorAgeMin {
+			return green
+		} else if age >= colorAgeMax {
+			return darkRed
+		}
+		factor := float64(age-colorAgeMin) / float64(colorAgeMax-colorAgeMin)
+		return interpolateColor(factor, green, darkRed)
+	}
+
+	white := Color{255, 255, 255}
+	size := *obj.Size
+	if size <= minObjectSizeLimit {
+		return white
+	} else if size >= maxObjectSizeLimit {
+		return darkRed
+	}
+	factor := float64(size) / float64(maxObjectSizeLimit)
+	return interpolateColor(factor, white, darkRed)
+}
+
+func (t *textWriter) WritePrefix(bucket, prefix string) error {
+	return t.printLabeled("PRE", bucket, prefix)
+}
+
+// printLabeled prints key with label in place of its size and date.
+func (t *textWriter) printLabeled(label, bucket, key string) error {
+	if len(t.columns) > 0 {
+		_, err := fmt.Fprintf(t.w, "%s %s\n", label, displayKey(bucket, key))
+		return err
+	}
+	// Right-align the label with the end of the date column.
+	width := t.sizeWidth + len(time.DateTime) + 1
+	if t.band {
+		width += bandWidth + 1
+	}
+	if t.percent {
+		width += len("100.00% ")
+	}
+	_, err := fmt.Fprintf(t.w, "%*s %s\n", width, label, displayKey(bucket, key))
+	return err
+}
+
+func (t *textWriter) Close() error {
+	// The objects are buffered, so the size column can fit the widest size.
+	for _, obj := range t.objs {
+		t.sizeWidth = max(t.sizeWidth, len(byteCountIEC(*obj.Size)))
+	}
+	for _, obj := range t.objs {
+		if err := t.print(obj); err != nil {
+			return err
+		}
+	}
+	return t.w.Close()
+}
+
+// bandWidth is the width in characters of a full -band bar.
+const bandWidth = 10
+
+// sizeBar draws a bar of block characters proportional to size/maxSize, with
+// an eighth of a character of precision.
+func sizeBar(size, maxSize int64) string {
+	if maxSize == 0 {
+		return ""
+	}
+	eighths := int(float64(size) / float64(maxSize) * bandWidth * 8)
+	bar := strings.Repeat("█", eighths/8)
+	if rest := eighths % 8; rest > 0 {
+		bar += string([]rune("▏▎▍▌▋▊▉")[rest-1])
+	}
+	return bar
+}
+
+// discardWriter drops the objects, when only the totals are printed.
+type discardWriter struct{}
+
+func (discardWriter) Write(object) error {
+	return nil
+}
+
+func (discardWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (discardWriter) Close() error {
+	return nil
+}
+
+// lockedWriter serializes the writes of concurrent listings to w. It can be
+// closed more than once, so an interrupted listing can be flushed while
+// others are still writing.
+type lockedWriter struct {
+	mu     sync.Mutex
+	w      objectWriter
+	closed bool
+}
+
+func (l *lockedWriter) Write(obj object) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errWriterClosed
+	}
+	return l.w.Write(obj)
+}
+
+func (l *lockedWriter) WritePrefix(bucket, prefix string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errWriterClosed
+	}
+	return l.w.WritePrefix(bucket, prefix)
+}
+
+func (l *lockedWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.w.Close()
+}
+
+var errWriterClosed = errors.New("output closed")
+
+// outputBufferSize is the size of the -output-buffered write buffer.
+const outputBufferSize = 64 * 1024
+
+// contentTypes are the Content-Type of the objects uploaded by -o s3:// for
+// each output format.
+var contentTypes = map[string]string{
+	"text":    "text/plain; charset=utf-8",
+	"json":    "application/json",
+	"ndjson":  "application/x-ndjson",
+	"csv":     "text/csv; charset=utf-8",
+	"tsv":     "text/tab-separated-values; charset=utf-8",
+	"parquet": "application/vnd.apache.parquet",
+	"html":    "text/html; charset=utf-8",
+}
+
+// output is the file, stdout or S3 object the objects are written to. Unless
+// it is a terminal, writes are buffered with -output-buffered, which is much
+// faster than writing each line for large listings.
+type output struct {
+	w   io.WriteCloser
+	buf *bufio.Writer
+
+	// appended is set when -append opened a file that already had content.
+	appended bool
+}
+
+// openOutput opens the file at path for writing, or for appending with
+// -append, or returns stdout when path is empty. A path of the form
+// s3://bucket/key is uploaded to S3 with contentType as it is written.
+func openOutput(ctx context.Context, cfg aws.Config, path, contentType string) (*output, error) {
+	if strings.HasPrefix(path, "s3://") {
+		u, err := newS3Upload(ctx, cfg, path, contentType)
+		if err != nil {
+			return nil, err
+		}
+		o := &output{w: u}
+		if outputBuffered {
+			o.buf = bufio.NewWriterSize(u, outputBufferSize)
+		}
+		return o, nil
+	}
+	f := os.Stdout
+	appended := false
+	if path != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendOutput {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		var err error
+		if f, err = os.OpenFile(path, flags, 0o666); err != nil {
+			return nil, err
+		}
+		if appendOutput {
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			appended = info.Size() > 0
+		}
+	}
+	o := &output{w: f, appended: appended}
+	if outputBuffered && !term.IsTerminal(int(f.Fd())) {
+		o.buf = bufio.NewWriterSize(f, outputBufferSize)
+	}
+	return o, nil
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.buf != nil {
+		return o.buf.Write(p)
+	}
+	return o.w.Write(p)
+}
+
+// Close flushes the buffered writes and closes the output unless it is
+// stdout.
+func (o *output) Close() error {
+	if o.buf != nil {
+		if err := o.buf.Flush(); err != nil {
+			return err
+		}
+	}
+	if o.w == os.Stdout {
+		return nil
+	}
+	return o.w.Close()
+}
+
+// parquetRecord is the schema of the rows written by -output parquet.
+type parquetRecord struct {
+	Key          string    `parquet:"key"`
+	Size         int64     `parquet:"size"`
+	LastModified time.Time `parquet:"last_modified,timestamp(millisecond)"`
+	StorageClass string    `parquet:"storage_class"`
+}
+
+// parquetBatchSize is the number of rows buffered before being handed to the
+// parquet writer.
+const parquetBatchSize = 1024
+
+type parquetWriter struct {
+	f     io.WriteCloser
+	w     *parquet.GenericWriter[parquetRecord]
+	batch []parquetRecord
+}
+
+func newParquetWriter(f io.WriteCloser) *parquetWriter {
+	return &parquetWriter{
+		f:     f,
+		w:     parquet.NewGenericWriter[parquetRecord](f),
+		batch: make([]parquetRecord, 0, parquetBatchSize),
+	}
+}
+
+func (p *parquetWriter) Write(obj object) error {
+	p.batch = append(p.batch, parquetRecord{
+		Key:          *obj.Key,
+		Size:         *obj.Size,
+		LastModified: *obj.LastModified,
+		StorageClass: string(obj.StorageClass),
+	})
+	if len(p.batch) < parquetBatchSize {
+		return nil
+	}
+	return p.flush()
+}
+
+func (p *parquetWriter) flush() error {
+	if _, err := p.w.Write(p.batch); err != nil {
+		return err
+	}
+	p.batch = p.batch[:0]
+	return nil
+}
+
+func (p *parquetWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if err := p.w.Close(); err != nil {
+		return err
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// readPrefixFile reads the newline-delimited prefixes of the file at path,
+// skipping blank lines and lines starting with #.
+func readPrefixFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prefixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefixes = append(prefixes, line)
+	}
+	return prefixes, scanner.Err()
+}
+
+// withTrailingSlash returns prefix ending with a slash, restricting it to the
+// keys within that folder rather than to every key starting with it. The
+// empty prefix, the whole bucket, is kept as is.
+func withTrailingSlash(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
+// hasGlob reports whether pattern contains glob metacharacters.
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandPrefix expands the glob metacharacters of pattern into the literal
+// prefixes of bucket matching it. Each "/"-separated segment containing a
+// glob is matched against the common prefixes of the prefixes expanded so
+// far, so this costs one delimiter listing per expanded prefix and per glob
+// segment. Globs only match whole "directories": use -filter to match the
+// object names.
+func expandPrefix(ctx context.Context, client *s3.Client, bucket, pattern string) ([]string, error) {
+	prefixes := []string{""}
+	for _, segment := range strings.SplitAfter(pattern, "/") {
+		if !hasGlob(segment) {
+			for i := range prefixes {
+				prefixes[i] += segment
+			}
+			continue
+		}
+		var expanded []string
+		for _, p := range prefixes {
+			common, err := listCommonPrefixes(ctx, client, bucket, p, "/")
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range common {
+				name := strings.TrimSuffix(strings.TrimPrefix(c, p), "/")
+				ok, err := path.Match(strings.TrimSuffix(segment, "/"), name)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					expanded = append(expanded, c)
+				}
+			}
+		}
+		prefixes = expanded
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// queryWriter writes the result of the -query JMESPath expression applied to
+// the JSON records: to the array of every record with -output json, or to each
+// record with -output ndjson, skipping those the expression yields null for.
+type queryWriter struct {
+	w       io.WriteCloser
+	query   *jmespath.JMESPath
+	lines   bool
+	records []any
+	count   int
+}
+
+func newQueryWriter(w io.WriteCloser, query *jmespath.JMESPath, lines bool) *queryWriter {
+	return &queryWriter{w: w, query: query, lines: lines, records: []any{}}
+}
+
+func (q *queryWriter) Write(obj object) error {
+	// The expression applies to the documented JSON field names, so the
+	// record goes through its JSON form.
+	r := newObjectRecord(obj)
+	indexRecord(&r, q.count)
+	q.count++
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var record any
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	if !q.lines {
+		q.records = append(q.records, record)
+		return nil
+	}
+	result, err := q.query.Search(record)
+	if err != nil || result == nil {
+		return err
+	}
+	return q.writeValue(result)
+}
+
+func (q *queryWriter) writeValue(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = q.w.Write(append(data, '\n'))
+	return err
+}
+
+func (q *queryWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (q *queryWriter) Close() error {
+	if !q.lines {
+		result, err := q.query.Search(q.records)
+		if err != nil {
+			return err
+		}
+		if err := q.writeResult(result); err != nil {
+			return err
+		}
+	}
+	return q.w.Close()
+}
+
+// writeResult writes result, one element per line when it is an array like
+// the -output json records.
+func (q *queryWriter) writeResult(result any) error {
+	values, ok := result.([]any)
+	if !ok || len(values) == 0 {
+		return q.writeValue(result)
+	}
+	for i, v := range values {
+		sep := ",\n"
+		if i == 0 {
+			sep = "[\n"
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(q.w, sep); err != nil {
+			return err
+		}
+		if _, err := q.w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(q.w, "\n]\n")
+	return err
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ObjectRecord is the documented shape of an object in the JSON outputs.
+// Fields must not be renamed or change type, as downstream consumers rely on
+// them.
+type ObjectRecord struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	LastModified time.Time         `json:"last_modified"`
+	StorageClass string            `json:"storage_class"`
+	ETag         string            `json:"etag"`
+	Lock         *LockRecord       `json:"lock,omitempty"`
+	Encryption   *EncryptionRecord `json:"encryption,omitempty"`
+	Change       string            `json:"change,omitempty"`
+	VersionID    string            `json:"version_id,omitempty"`
+	IsLatest     *bool             `json:"is_latest,omitempty"`
+	Index        *int              `json:"index,omitempty"`
+}
+
+// LockRecord is the Object Lock state of an object, set with -locks.
+type LockRecord struct {
+	RetentionMode string     `json:"retention_mode,omitempty"`
+	RetainUntil   *time.Time `json:"retain_until,omitempty"`
+	LegalHold     bool       `json:"legal_hold"`
+}
+
+// EncryptionRecord is the server-side encryption of an object, set with
+// -show-encryption. The algorithm is empty when the object is not encrypted.
+type EncryptionRecord struct {
+	Algorithm string `json:"algorithm"`
+	KMSKeyID  string `json:"kms_key_id,omitempty"`
+}
+
+func newObjectRecord(obj object) ObjectRecord {
+	r := ObjectRecord{
+		Bucket:       obj.bucket,
+		Key:          *obj.Key,
+		Size:         *obj.Size,
+		LastModified: obj.LastModified.UTC(),
+		StorageClass: string(obj.StorageClass),
+		Change:       obj.change,
+	}
+	if obj.encryption != nil {
+		r.Encryption = &EncryptionRecord{
+			Algorithm: string(obj.encryption.algorithm),
+			KMSKeyID:  obj.encryption.kmsKeyID,
+		}
+	}
+	if obj.versionID != "" {
+		r.VersionID = obj.versionID
+		r.IsLatest = &obj.isLatest
+	}
+	if obj.ETag != nil {
+		r.ETag = strings.Trim(*obj.ETag, `"`)
+	}
+	if obj.lock != nil {
+		r.Lock = &LockRecord{
+			RetentionMode: string(obj.lock.mode),
+			RetainUntil:   obj.lock.retainUntil,
+			LegalHold:     obj.lock.legalHold,
+		}
+	}
+	return r
+}
+
+// StatsRecord is the shape of the -stats-json output.
+type StatsRecord struct {
+	Bucket         string                 `json:"bucket"`
+	Prefix         string                 `json:"prefix"`
+	Objects        int64                  `json:"objects"`
+	Bytes          int64                  `json:"bytes"`
+	StorageClasses map[string]UsageRecord `json:"storage_classes"`
+	ElapsedSeconds float64                `json:"elapsed_seconds"`
+
+	// Percentiles are the size percentiles with -percentiles, such as
+	// "p50", and the largest size as "max".
+	Percentiles map[string]int64 `json:"percentiles,omitempty"`
+}
+
+// GroupsRecord is the -group-by table with -output json, the groups being
+// sorted by size. The group of the objects without one is empty.
+type GroupsRecord struct {
+	GroupBy string        `json:"group_by"`
+	Groups  []GroupRecord `json:"groups"`
+	Total   UsageRecord   `json:"total"`
+}
+
+// GroupRecord is a group of objects and its percentage of the total size.
+type GroupRecord struct {
+	Group   string  `json:"group"`
+	Objects int64   `json:"objects"`
+	Bytes   int64   `json:"bytes"`
+	Percent float64 `json:"percent"`
+}
+
+// UsageRecord is an object count and total size.
+type UsageRecord struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+}
+
+func newStatsRecord(total *stats, elapsed time.Duration) StatsRecord {
+	r := StatsRecord{
+		Bucket:         bucketName,
+		Prefix:         bucketPrefix,
+		Objects:        total.count,
+		Bytes:          total.size,
+		StorageClasses: map[string]UsageRecord{},
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+	if bucketsMatching != "" {
+		r.Bucket = bucketsMatching
+	} else if r.Bucket == "" {
+		r.Bucket = strings.Join(regionBuckets, ",")
+	}
+	for class, u := range total.classes {
+		r.StorageClasses[class] = UsageRecord{Objects: u.count, Bytes: u.size}
+	}
+	if p, largest := total.percentiles(); p != nil {
+		r.Percentiles = map[string]int64{"max": largest}
+		for rank, size := range p {
+			r.Percentiles[fmt.Sprintf("p%d", rank)] = size
+		}
+	}
+	return r
+}
+
+// jsonWriter writes the objects as a JSON array, or as newline-delimited
+// JSON when lines is set.
+type jsonWriter struct {
+	w     io.WriteCloser
+	lines bool
+	count int
+}
+
+func newJSONWriter(w io.WriteCloser, lines bool) *jsonWriter {
+	return &jsonWriter{w: w, lines: lines}
+}
+
+// indexRecord sets the index of r to i with -index.
+func indexRecord(r *ObjectRecord, i int) {
+	if indexRecords {
+		r.Index = &i
+	}
+}
+
+func (j *jsonWriter) Write(obj object) error {
+	r := newObjectRecord(obj)
+	// The writes are serialized, so the records are numbered in output
+	// order even when several listings run at once.
+	indexRecord(&r, j.count)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var sep string
+	switch {
+	case j.lines:
+	case j.count == 0:
+		sep = "[\n"
+	default:
+		sep = ",\n"
+	}
+	j.count++
+	if j.lines {
+		data = append(data, '\n')
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.lines {
+		end := "\n]\n"
+		if j.count == 0 {
+			end = "[]\n"
+		}
+		if _, err := io.WriteString(j.w, end); err != nil {
+			return err
+		}
+	}
+	return j.w.Close()
+}
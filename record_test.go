@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestObjectRecordJSON(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	retainUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := types.Object{
+		Key:          aws.String("logs/2024/a.log"),
+		Size:         aws.Int64(1024),
+		LastModified: &modified,
+		StorageClass: types.ObjectStorageClassStandardIa,
+		ETag:         aws.String(`"abf7f0c50f9f08c680c97d669f346e3c"`),
+	}
+	tests := []struct {
+		name string
+		obj  object
+		want string
+	}{
+		{
+			name: "minimal",
+			obj:  object{Object: base, bucket: "bucket"},
+			want: `{"bucket":"bucket","key":"logs/2024/a.log","size":1024,"last_modified":"2024-03-01T11:30:00Z","storage_class":"STANDARD_IA","etag":"abf7f0c50f9f08c680c97d669f346e3c"}`,
+		},
+		{
+			name: "every field",
+			obj: object{
+				Object:     base,
+				bucket:     "bucket",
+				lock:       &lockStatus{mode: types.ObjectLockRetentionModeGovernance, retainUntil: &retainUntil, legalHold: true},
+				encryption: &encryptionStatus{algorithm: types.ServerSideEncryptionAwsKms, kmsKeyID: "arn:aws:kms:eu-west-1:123456789012:key/k"},
+				versionID:  "v1",
+				isLatest:   true,
+				change:     changeAdded,
+			},
+			want: `{"bucket":"bucket","key":"logs/2024/a.log","size":1024,"last_modified":"2024-03-01T11:30:00Z","storage_class":"STANDARD_IA","etag":"abf7f0c50f9f08c680c97d669f346e3c",` +
+				`"lock":{"retention_mode":"GOVERNANCE","retain_until":"2030-01-01T00:00:00Z","legal_hold":true},` +
+				`"encryption":{"algorithm":"aws:kms","kms_key_id":"arn:aws:kms:eu-west-1:123456789012:key/k"},` +
+				`"change":"added","version_id":"v1","is_latest":true}`,
+		},
+		{
+			name: "noncurrent version",
+			obj:  object{Object: base, bucket: "bucket", versionID: "v0"},
+			want: `{"bucket":"bucket","key":"logs/2024/a.log","size":1024,"last_modified":"2024-03-01T11:30:00Z","storage_class":"STANDARD_IA","etag":"abf7f0c50f9f08c680c97d669f346e3c","version_id":"v0","is_latest":false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(newObjectRecord(tt.obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("index", func(t *testing.T) {
+		indexRecords = true
+		defer func() { indexRecords = false }()
+		r := newObjectRecord(object{Object: base, bucket: "bucket"})
+		indexRecord(&r, 3)
+		got, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"bucket":"bucket","key":"logs/2024/a.log","size":1024,"last_modified":"2024-03-01T11:30:00Z","storage_class":"STANDARD_IA","etag":"abf7f0c50f9f08c680c97d669f346e3c","index":3}`
+		if string(got) != want {
+			t.Errorf("got  %s\nwant %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// redactedLength is the number of hex digits a redacted path segment keeps of
+// its hash.
+const redactedLength = 12
+
+// maxKeptExtension is the length of the longest extension -redact keeps, as
+// longer ones are more likely a part of the name than a file type.
+const maxKeptExtension = 8
+
+// redactor replaces each path segment of the keys below -prefix with a
+// salted hash of it, keeping the extension of the last one. The same segment
+// gets the same hash within a report, so the hierarchy and the sizes and
+// dates can still be discussed, but the names cannot be recovered without
+// the salt.
+type redactor struct {
+	salt []byte
+}
+
+// keyRedactor is the redactor of -redact, shared by the output and the logs.
+var keyRedactor *redactor
+
+// newRedactor returns a redactor hashing with salt, or with a random salt
+// when empty, so that the reports cannot be correlated with each other.
+func newRedactor(salt string) *redactor {
+	key := []byte(salt)
+	if salt == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &redactor{salt: key}
+}
+
+// printedKey returns key as printed outside of the object writers, by the
+// logs and the modes listing something else than objects: redacted with
+// -redact, else unchanged.
+func printedKey(key string) string {
+	if keyRedactor == nil {
+		return key
+	}
+	return keyRedactor.redact(key)
+}
+
+// redact returns key with the segments below -prefix hashed.
+func (r *redactor) redact(key string) string {
+	rest, ok := strings.CutPrefix(key, bucketPrefix)
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		ext := ""
+		if i == len(segments)-1 {
+			if ext = path.Ext(segment); len(ext) > maxKeptExtension || ext == segment {
+				ext = ""
+			}
+		}
+		h := hmac.New(sha256.New, r.salt)
+		h.Write([]byte(strings.TrimSuffix(segment, ext)))
+		segments[i] = hex.EncodeToString(h.Sum(nil))[:redactedLength] + ext
+	}
+	redacted := strings.Join(segments, "/")
+	if ok {
+		return bucketPrefix + redacted
+	}
+	return redacted
+}
+
+// redactWriter writes the objects to w with their keys redacted by r.
+type redactWriter struct {
+	w objectWriter
+	r *redactor
+}
+
+func (r *redactWriter) Write(obj object) error {
+	obj.Key = aws.String(r.r.redact(*obj.Key))
+	return r.w.Write(obj)
+}
+
+func (r *redactWriter) WritePrefix(bucket, prefix string) error {
+	return r.w.WritePrefix(bucket, r.r.redact(prefix))
+}
+
+func (r *redactWriter) Close() error {
+	return r.w.Close()
+}
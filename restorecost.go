@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// restoreRate is the retrieval price of a storage class and tier, per GB
+// restored and per 1,000 restore requests.
+type restoreRate struct {
+	perGB, perThousand float64
+}
+
+// restoreTiers are the retrieval tiers, fastest first.
+var restoreTiers = []types.Tier{types.TierExpedited, types.TierStandard, types.TierBulk}
+
+// restoreRates are the approximate us-east-1 retrieval prices by storage
+// class and tier, which -restore-rates overrides. Deep Archive has no
+// expedited tier.
+var restoreRates = map[types.ObjectStorageClass]map[types.Tier]restoreRate{
+	types.ObjectStorageClassGlacier: {
+		types.TierExpedited: {perGB: 0.03, perThousand: 10},
+		types.TierStandard:  {perGB: 0.01, perThousand: 0.05},
+		types.TierBulk:      {perGB: 0, perThousand: 0},
+	},
+	types.ObjectStorageClassDeepArchive: {
+		types.TierStandard: {perGB: 0.02, perThousand: 0.10},
+		types.TierBulk:     {perGB: 0.0025, perThousand: 0.025},
+	},
+}
+
+// parseRestoreRates overrides restoreRates with the -restore-rates list of
+// class.tier=price pairs, such as GLACIER.Bulk=0.0025, the price being per GB.
+func parseRestoreRates(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		name, price, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		class, tier, ok2 := strings.Cut(name, ".")
+		if !ok || !ok2 {
+			return fmt.Errorf("expected CLASS.Tier=price, got %q", pair)
+		}
+		rates, ok := restoreRates[types.ObjectStorageClass(strings.ToUpper(class))]
+		if !ok {
+			return fmt.Errorf("unknown storage class %q, expected GLACIER or DEEP_ARCHIVE", class)
+		}
+		i := slices.IndexFunc(restoreTiers, func(t types.Tier) bool { return strings.EqualFold(string(t), tier) })
+		if i < 0 {
+			return fmt.Errorf("unknown tier %q, expected Expedited, Standard or Bulk", tier)
+		}
+		perGB, err := strconv.ParseFloat(price, 64)
+		if err != nil || perGB < 0 {
+			return fmt.Errorf("invalid price %q", price)
+		}
+		rate, ok := rates[restoreTiers[i]]
+		if !ok {
+			return fmt.Errorf("%s has no %s tier", strings.ToUpper(class), restoreTiers[i])
+		}
+		rate.perGB = perGB
+		rates[restoreTiers[i]] = rate
+	}
+	return nil
+}
+
+// restoreCostWriter sums the archived objects by storage class and prints
+// the estimated cost of restoring them with each tier when closed.
+type restoreCostWriter struct {
+	w       io.WriteCloser
+	classes map[types.ObjectStorageClass]*usage
+	skipped usage
+}
+
+func newRestoreCostWriter(w io.WriteCloser) *restoreCostWriter {
+	return &restoreCostWriter{w: w, classes: map[types.ObjectStorageClass]*usage{}}
+}
+
+func (r *restoreCostWriter) Write(obj object) error {
+	o := usage{count: 1, size: *obj.Size}
+	if _, ok := restoreRates[obj.StorageClass]; !ok {
+		r.skipped.add(o)
+		return nil
+	}
+	u, ok := r.classes[obj.StorageClass]
+	if !ok {
+		u = &usage{}
+		r.classes[obj.StorageClass] = u
+	}
+	u.add(o)
+	return nil
+}
+
+// WritePrefix drops the common prefixes, they have nothing to restore.
+func (r *restoreCostWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (r *restoreCostWriter) Close() error {
+	fmt.Fprintln(r.w, "Estimated restore cost, from approximate us-east-1 prices that -restore-rates overrides:")
+	classes := make([]types.ObjectStorageClass, 0, len(r.classes))
+	for class := range r.classes {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+	for _, class := range classes {
+		u := r.classes[class]
+		fmt.Fprintf(r.w, "%s: %d objects, %s\n", class, u.count, byteCountIEC(u.size))
+		gb := float64(u.size) / (1 << 30)
+		for _, tier := range restoreTiers {
+			rate, ok := restoreRates[class][tier]
+			if !ok {
+				continue
+			}
+			cost := gb*rate.perGB + float64(u.count)/1000*rate.perThousand
+			fmt.Fprintf(r.w, "  %-9s ~$%.2f\n", tier, cost)
+		}
+	}
+	if len(classes) == 0 {
+		fmt.Fprintln(r.w, "no archived objects to restore")
+	}
+	if r.skipped.count > 0 {
+		fmt.Fprintf(r.w, "%d objects (%s) in other storage classes need no restore\n", r.skipped.count, byteCountIEC(r.skipped.size))
+	}
+	return r.w.Close()
+}
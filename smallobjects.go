@@ -0,0 +1,112 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/c2h5oh/datasize"
+)
+
+// minBillableSizes are the sizes the storage classes bill an object for at
+// least, which -min-billable overrides. The archive classes instead add 40KB
+// of metadata to each object whatever its size, which is not counted.
+var minBillableSizes = map[types.ObjectStorageClass]int64{
+	types.ObjectStorageClassStandardIa: 128 << 10,
+	types.ObjectStorageClassOnezoneIa:  128 << 10,
+	types.ObjectStorageClassGlacierIr:  128 << 10,
+}
+
+// parseMinBillable overrides minBillableSizes with the -min-billable list of
+// class=size pairs, such as GLACIER_IR=128KB.
+func parseMinBillable(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		class, size, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("expected CLASS=size, got %q", pair)
+		}
+		class = strings.ToUpper(class)
+		if !slices.Contains(types.ObjectStorageClass("").Values(), types.ObjectStorageClass(class)) {
+			return fmt.Errorf("unknown storage class %q", class)
+		}
+		var min datasize.ByteSize
+		if err := min.UnmarshalText([]byte(size)); err != nil {
+			return fmt.Errorf("invalid size %q", size)
+		}
+		minBillableSizes[types.ObjectStorageClass(class)] = int64(min.Bytes())
+	}
+	return nil
+}
+
+// smallObjectsWriter sums by storage class the objects smaller than a
+// threshold, the candidates for packing into larger objects, and prints when
+// closed how much more than their size they are billed for.
+type smallObjectsWriter struct {
+	w         io.WriteCloser
+	threshold int64
+	classes   map[types.ObjectStorageClass]*smallUsage
+	total     usage
+}
+
+// smallUsage is the usage of the small objects of a storage class, with the
+// size they are billed for.
+type smallUsage struct {
+	usage
+	billed int64
+}
+
+func newSmallObjectsWriter(w io.WriteCloser, threshold int64) *smallObjectsWriter {
+	return &smallObjectsWriter{w: w, threshold: threshold, classes: map[types.ObjectStorageClass]*smallUsage{}}
+}
+
+func (s *smallObjectsWriter) Write(obj object) error {
+	o := usage{count: 1, size: *obj.Size}
+	s.total.add(o)
+	if *obj.Size >= s.threshold {
+		return nil
+	}
+	// The listings leave the storage class of STANDARD objects empty.
+	class := cmp.Or(obj.StorageClass, types.ObjectStorageClassStandard)
+	u, ok := s.classes[class]
+	if !ok {
+		u = &smallUsage{}
+		s.classes[class] = u
+	}
+	u.add(o)
+	u.billed += max(*obj.Size, minBillableSizes[class])
+	return nil
+}
+
+// WritePrefix drops the common prefixes, they are not billed.
+func (s *smallObjectsWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (s *smallObjectsWriter) Close() error {
+	classes := make([]types.ObjectStorageClass, 0, len(s.classes))
+	for class := range s.classes {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	var small smallUsage
+	var wasted float64
+	fmt.Fprintf(s.w, "Objects smaller than %s, billed with the minimum sizes that -min-billable overrides and approximate us-east-1 prices:\n", byteCountIEC(s.threshold))
+	fmt.Fprintf(s.w, "%-19s %10s %9s %9s %13s\n", "CLASS", "COUNT", "SIZE", "BILLED", "OVERHEAD")
+	for _, class := range classes {
+		u := s.classes[class]
+		cost := float64(u.billed-u.size) / (1 << 30) * storagePrices[types.StorageClass(class)]
+		fmt.Fprintf(s.w, "%-19s %10d %9s %9s %8s/month\n", class, u.count, byteCountIEC(u.size), byteCountIEC(u.billed), fmt.Sprintf("~$%.2f", cost))
+		small.add(u.usage)
+		small.billed += u.billed
+		wasted += cost
+	}
+	fmt.Fprintf(s.w, "%-19s %10d %9s %9s %8s/month\n", "TOTAL", small.count, byteCountIEC(small.size), byteCountIEC(small.billed), fmt.Sprintf("~$%.2f", wasted))
+	if s.total.count > 0 {
+		fmt.Fprintf(s.w, "%d of the %d objects (%.1f%%) are candidates for packing\n", small.count, s.total.count, 100*float64(small.count)/float64(s.total.count))
+	}
+	return s.w.Close()
+}
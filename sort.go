@@ -0,0 +1,87 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// objectOrders are the -sort orders: the keys alphabetically, the largest
+// objects first, or the most recently modified first.
+var objectOrders = map[string]func(a, b object) int{
+	"key": func(a, b object) int {
+		if c := strings.Compare(a.bucket, b.bucket); c != 0 {
+			return c
+		}
+		return strings.Compare(*a.Key, *b.Key)
+	},
+	"size": func(a, b object) int {
+		return cmp.Compare(*b.Size, *a.Size)
+	},
+	"date": func(a, b object) int {
+		return b.LastModified.Compare(*a.LastModified)
+	},
+}
+
+// sortWriter buffers the objects and writes them sorted to w when closed.
+// With a limit, only the first limit objects in that order are kept, in a
+// heap whose root is the last of them, so that memory stays bounded however
+// many objects are listed.
+type sortWriter struct {
+	w     objectWriter
+	cmp   func(a, b object) int
+	limit int
+	objs  []object
+}
+
+func newSortWriter(w objectWriter, order string, limit int) (*sortWriter, error) {
+	cmp, ok := objectOrders[order]
+	if !ok {
+		return nil, fmt.Errorf("-sort must be key, size or date")
+	}
+	return &sortWriter{w: w, cmp: cmp, limit: limit}, nil
+}
+
+func (s *sortWriter) Write(obj object) error {
+	if s.limit <= 0 {
+		s.objs = append(s.objs, obj)
+		return nil
+	}
+	if len(s.objs) < s.limit {
+		heap.Push(s, obj)
+		return nil
+	}
+	if s.cmp(obj, s.objs[0]) < 0 {
+		s.objs[0] = obj
+		heap.Fix(s, 0)
+	}
+	return nil
+}
+
+func (s *sortWriter) WritePrefix(bucket, prefix string) error {
+	return s.w.WritePrefix(bucket, prefix)
+}
+
+func (s *sortWriter) Close() error {
+	slices.SortStableFunc(s.objs, s.cmp)
+	for _, obj := range s.objs {
+		if err := s.w.Write(obj); err != nil {
+			return err
+		}
+	}
+	return s.w.Close()
+}
+
+// These implement heap.Interface, ordering the kept objects in reverse so
+// that the root is the first to be evicted.
+func (s *sortWriter) Len() int           { return len(s.objs) }
+func (s *sortWriter) Less(i, j int) bool { return s.cmp(s.objs[i], s.objs[j]) > 0 }
+func (s *sortWriter) Swap(i, j int)      { s.objs[i], s.objs[j] = s.objs[j], s.objs[i] }
+func (s *sortWriter) Push(x any)         { s.objs = append(s.objs, x.(object)) }
+func (s *sortWriter) Pop() any {
+	obj := s.objs[len(s.objs)-1]
+	s.objs = s.objs[:len(s.objs)-1]
+	return obj
+}
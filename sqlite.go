@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is the objects table of -sqlite. The modification times are
+// in UTC, in the format of the SQLite date and time functions.
+const sqliteSchema = `
+DROP TABLE IF EXISTS objects;
+CREATE TABLE objects (
+	bucket        TEXT NOT NULL,
+	key           TEXT NOT NULL,
+	size          INTEGER NOT NULL,
+	last_modified TEXT NOT NULL,
+	storage_class TEXT NOT NULL,
+	etag          TEXT NOT NULL,
+	version_id    TEXT
+);`
+
+// sqliteIndexes are created once the rows are inserted, which is faster than
+// updating them on each insert.
+const sqliteIndexes = `
+CREATE INDEX objects_key ON objects (bucket, key);
+CREATE INDEX objects_size ON objects (size);`
+
+// sqliteWriter writes the objects to the objects table of a SQLite database,
+// replacing the table of a previous run, and passes them on to next. The rows
+// are inserted in a single transaction committed when closed.
+type sqliteWriter struct {
+	next   objectWriter
+	db     *sql.DB
+	tx     *sql.Tx
+	insert *sql.Stmt
+}
+
+func newSQLiteWriter(path string, next objectWriter) (*sqliteWriter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqliteWriter{next: next, db: db}
+	if err := s.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteWriter) begin() error {
+	if _, err := s.db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	var err error
+	if s.tx, err = s.db.Begin(); err != nil {
+		return err
+	}
+	s.insert, err = s.tx.Prepare(`INSERT INTO objects VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	return err
+}
+
+func (s *sqliteWriter) Write(obj object) error {
+	r := newObjectRecord(obj)
+	var versionID any
+	if r.VersionID != "" {
+		versionID = r.VersionID
+	}
+	_, err := s.insert.Exec(r.Bucket, r.Key, r.Size, r.LastModified.Format("2006-01-02 15:04:05"), r.StorageClass, r.ETag, versionID)
+	if err != nil {
+		return err
+	}
+	return s.next.Write(obj)
+}
+
+func (s *sqliteWriter) WritePrefix(bucket, prefix string) error {
+	return s.next.WritePrefix(bucket, prefix)
+}
+
+func (s *sqliteWriter) Close() error {
+	err := s.tx.Commit()
+	if err == nil {
+		_, err = s.db.Exec(sqliteIndexes)
+	}
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return s.next.Close()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData is what a -format-file template is executed with. The objects
+// have the fields of the JSON records, with their full keys.
+type templateData struct {
+	// Target describes what was listed, like the confirmation prompts.
+	Target   string
+	Objects  []ObjectRecord
+	Prefixes []string
+	// Count and Size are the totals of Objects.
+	Count     int64
+	Size      int64
+	Generated time.Time
+}
+
+// templateFuncs are the functions the templates can call besides the
+// builtin ones.
+var templateFuncs = map[string]any{
+	"size": byteCountIEC,
+	"date": func(t time.Time) string {
+		return t.Local().Format(time.DateTime)
+	},
+	"age": func(t time.Time) string {
+		return humanizeAge(t, startTime)
+	},
+	"uri": func(r ObjectRecord) string {
+		return "s3://" + r.Bucket + "/" + r.Key
+	},
+}
+
+// executor is implemented by the text and HTML templates.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// parseTemplate parses the -format-file template at path, as an HTML
+// template escaping the values when it ends in .html or .htm.
+func parseTemplate(path string) (executor, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return htmltemplate.New(name).Funcs(templateFuncs).Parse(string(src))
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(string(src))
+}
+
+// templateWriter buffers the objects and executes a template once over all
+// of them when closed.
+type templateWriter struct {
+	w    io.WriteCloser
+	tmpl executor
+	data templateData
+}
+
+func newTemplateWriter(w io.WriteCloser, tmpl executor) *templateWriter {
+	return &templateWriter{w: w, tmpl: tmpl, data: templateData{Target: targetDescription()}}
+}
+
+func (t *templateWriter) Write(obj object) error {
+	r := newObjectRecord(obj)
+	t.data.Objects = append(t.data.Objects, r)
+	t.data.Count++
+	t.data.Size += r.Size
+	return nil
+}
+
+func (t *templateWriter) WritePrefix(bucket, prefix string) error {
+	t.data.Prefixes = append(t.data.Prefixes, prefix)
+	return nil
+}
+
+func (t *templateWriter) Close() error {
+	t.data.Generated = time.Now()
+	if err := t.tmpl.Execute(t.w, t.data); err != nil {
+		t.w.Close()
+		return err
+	}
+	return t.w.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// timelineBarWidth is the width of the bar of the period with the most
+// objects.
+const timelineBarWidth = 40
+
+// timelinePeriods maps the -timeline granularities to the function truncating
+// a time in location to the start of its period, and to the layout of the
+// period labels.
+var timelinePeriods = map[string]struct {
+	truncate func(t time.Time) time.Time
+	layout   string
+}{
+	"hour": {
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		},
+		layout: "2006-01-02 15:00",
+	},
+	"day": {
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		},
+		layout: time.DateOnly,
+	},
+	"week": {
+		// The weeks start on Monday.
+		truncate: func(t time.Time) time.Time {
+			offset := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+		},
+		layout: time.DateOnly,
+	},
+	"month": {
+		truncate: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		},
+		layout: "2006-01",
+	},
+}
+
+// timelineWriter counts the objects by the period of their modification
+// time in -timezone, and prints the periods chronologically with a bar
+// scaled to their object count when closed.
+type timelineWriter struct {
+	w        io.WriteCloser
+	truncate func(t time.Time) time.Time
+	layout   string
+	periods  map[time.Time]*usage
+	total    usage
+}
+
+func newTimelineWriter(w io.WriteCloser, granularity string) (*timelineWriter, error) {
+	period, ok := timelinePeriods[granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown -timeline %q, expected hour, day, week or month", granularity)
+	}
+	return &timelineWriter{w: w, truncate: period.truncate, layout: period.layout, periods: map[time.Time]*usage{}}, nil
+}
+
+func (t *timelineWriter) Write(obj object) error {
+	start := t.truncate(obj.LastModified.In(location))
+	u, ok := t.periods[start]
+	if !ok {
+		u = &usage{}
+		t.periods[start] = u
+	}
+	o := usage{count: 1, size: *obj.Size}
+	u.add(o)
+	t.total.add(o)
+	return nil
+}
+
+// WritePrefix drops the common prefixes, they have no modification time.
+func (t *timelineWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (t *timelineWriter) Close() error {
+	starts := make([]time.Time, 0, len(t.periods))
+	var most int64
+	for start, u := range t.periods {
+		starts = append(starts, start)
+		most = max(most, u.count)
+	}
+	slices.SortFunc(starts, time.Time.Compare)
+
+	width := max(len(t.layout), len("TOTAL"))
+	fmt.Fprintf(t.w, "%-*s %10s %9s\n", width, "PERIOD", "COUNT", "SIZE")
+	for _, start := range starts {
+		u := t.periods[start]
+		bar := strings.Repeat("#", int(max(1, u.count*timelineBarWidth/most)))
+		fmt.Fprintf(t.w, "%-*s %10d %9s  %s\n", width, start.Format(t.layout), u.count, byteCountIEC(u.size), bar)
+	}
+	fmt.Fprintf(t.w, "%-*s %10d %9s\n", width, "TOTAL", t.total.count, byteCountIEC(t.total.size))
+	return t.w.Close()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// keyTransform is a -key-transform substitution, s/pattern/replacement/ with
+// an optional g flag replacing every match instead of the first.
+type keyTransform struct {
+	re          *regexp.Regexp
+	replacement string
+	global      bool
+}
+
+// parseKeyTransform parses a sed-like s/pattern/replacement/[g] substitution,
+// with any delimiter following the s, which a backslash escapes. Like sed,
+// the replacement refers to the groups as \1 to \9 and to the match as &.
+func parseKeyTransform(value string) (keyTransform, error) {
+	if len(value) < 2 || value[0] != 's' {
+		return keyTransform{}, errors.New("expected s/pattern/replacement/")
+	}
+	delim := value[1]
+	var parts []string
+	var part strings.Builder
+	for i := 2; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == delim:
+			part.WriteByte(delim)
+			i++
+		case value[i] == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(value[i])
+		}
+	}
+	if len(parts) != 2 {
+		return keyTransform{}, errors.New("expected s/pattern/replacement/")
+	}
+	t := keyTransform{replacement: sedReplacement(parts[1])}
+	switch flags := part.String(); flags {
+	case "":
+	case "g":
+		t.global = true
+	default:
+		return keyTransform{}, fmt.Errorf("unknown flags %q, expected g", flags)
+	}
+	var err error
+	if t.re, err = regexp.Compile(parts[0]); err != nil {
+		return keyTransform{}, err
+	}
+	return t, nil
+}
+
+// sedReplacement returns the sed replacement s in the syntax of
+// regexp.Expand.
+func sedReplacement(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			if next := s[i]; next >= '0' && next <= '9' {
+				fmt.Fprintf(&b, "${%c}", next)
+			} else if next == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(next)
+			}
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// apply returns key with the substitution made.
+func (t keyTransform) apply(key string) string {
+	if t.global {
+		return t.re.ReplaceAllString(key, t.replacement)
+	}
+	m := t.re.FindStringSubmatchIndex(key)
+	if m == nil {
+		return key
+	}
+	dst := t.re.ExpandString([]byte(key[:m[0]]), t.replacement, key, m)
+	return string(dst) + key[m[1]:]
+}
+
+// transformWriter writes the objects to w with the -key-transform
+// substitutions made to their keys, in order. Like -normalize-unicode-keys it
+// only changes what is printed, to preview a renaming scheme: the objects are
+// matched, fetched and modified with their real keys.
+type transformWriter struct {
+	w          objectWriter
+	transforms []keyTransform
+}
+
+func (t transformWriter) transform(key string) string {
+	for _, tr := range t.transforms {
+		key = tr.apply(key)
+	}
+	return key
+}
+
+func (t transformWriter) Write(obj object) error {
+	obj.Key = aws.String(t.transform(*obj.Key))
+	return t.w.Write(obj)
+}
+
+func (t transformWriter) WritePrefix(bucket, prefix string) error {
+	return t.w.WritePrefix(bucket, t.transform(prefix))
+}
+
+func (t transformWriter) Close() error {
+	return t.w.Close()
+}
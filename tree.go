@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// treeNode is a directory or object of the -tree view, with the usage of
+// everything below it. The directory names end with the separator, so that
+// an object and a directory of the same name are told apart.
+type treeNode struct {
+	name     string
+	dir      bool
+	children map[string]*treeNode
+	usage
+}
+
+func newTreeNode(name string, dir bool) *treeNode {
+	return &treeNode{name: name, dir: dir, children: map[string]*treeNode{}}
+}
+
+// child returns the child of n named name, adding it if needed.
+func (n *treeNode) child(name string, dir bool) *treeNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = newTreeNode(name, dir)
+		n.children[name] = c
+	}
+	return c
+}
+
+// treeWriter builds a tree of the listed keys, split on sep, and prints it
+// like the tree command when closed, with the size of every directory.
+type treeWriter struct {
+	w     io.WriteCloser
+	sep   string
+	roots map[string]*treeNode
+}
+
+func newTreeWriter(w io.WriteCloser, sep string) *treeWriter {
+	return &treeWriter{w: w, sep: sep, roots: map[string]*treeNode{}}
+}
+
+func (t *treeWriter) Write(obj object) error {
+	root, ok := t.roots[obj.bucket]
+	if !ok {
+		root = newTreeNode(fmt.Sprintf("s3://%s/%s", obj.bucket, bucketPrefix), true)
+		t.roots[obj.bucket] = root
+	}
+	u := usage{count: 1, size: *obj.Size}
+	root.add(u)
+
+	// A key ending with the separator is a directory marker, counted in the
+	// directory itself.
+	segments := strings.Split(strings.TrimPrefix(*obj.Key, bucketPrefix), t.sep)
+	node := root
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if last && segment == "" {
+			break
+		}
+		if !last {
+			segment += t.sep
+		}
+		node = node.child(segment, !last)
+		node.add(u)
+	}
+	return nil
+}
+
+// WritePrefix drops the common prefixes, -tree lists recursively.
+func (t *treeWriter) WritePrefix(string, string) error {
+	return nil
+}
+
+func (t *treeWriter) Close() error {
+	buckets := make([]string, 0, len(t.roots))
+	for bucket := range t.roots {
+		buckets = append(buckets, bucket)
+	}
+	slices.Sort(buckets)
+	for _, bucket := range buckets {
+		root := t.roots[bucket]
+		fmt.Fprintf(t.w, "%s (%s)\n", root.name, describeTreeUsage(root))
+		printTreeChildren(t.w, root, "")
+	}
+	return t.w.Close()
+}
+
+// printTreeChildren prints the children of n sorted by name, each line
+// starting with indent and the tree connectors.
+func printTreeChildren(w io.Writer, n *treeNode, indent string) {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for i, name := range names {
+		c := n.children[name]
+		connector, next := "├── ", "│   "
+		if i == len(names)-1 {
+			connector, next = "└── ", "    "
+		}
+		if !c.dir {
+			fmt.Fprintf(w, "%s%s%s (%s)\n", indent, connector, name, byteCountIEC(c.size))
+			continue
+		}
+		fmt.Fprintf(w, "%s%s%s (%s)\n", indent, connector, name, describeTreeUsage(c))
+		printTreeChildren(w, c, indent+next)
+	}
+}
+
+// describeTreeUsage describes the total size and object count of a
+// directory.
+func describeTreeUsage(n *treeNode) string {
+	noun := "objects"
+	if n.count == 1 {
+		noun = "object"
+	}
+	return fmt.Sprintf("%s, %d %s", byteCountIEC(n.size), n.count, noun)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Upload streams its writes to an S3 object through the upload manager, so
+// that no local file is needed. The object is complete once closed.
+type s3Upload struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// newS3Upload starts uploading to the s3://bucket/key uri.
+func newS3Upload(ctx context.Context, cfg aws.Config, uri, contentType string) (*s3Upload, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newBucketClient(ctx, cfg, bucket)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	u := &s3Upload{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			Body:        pr,
+			ContentType: &contentType,
+		})
+		// Fail the pending and later writes when the upload fails.
+		pr.CloseWithError(err)
+		u.done <- err
+	}()
+	return u, nil
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	return u.pw.Write(p)
+}
+
+// Close ends the object and waits for the upload to complete.
+func (u *s3Upload) Close() error {
+	u.pw.Close()
+	return <-u.done
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// usage is the aggregated object count and size below a prefix.
+type usage struct {
+	count int64
+	size  int64
+}
+
+func (u *usage) add(o usage) {
+	u.count += o.count
+	u.size += o.size
+}
+
+// stats accumulates the usage of the matched objects, in total and per
+// storage class, along with their sizes with -percentiles.
+type stats struct {
+	usage
+	classes map[string]*usage
+	sizes   []int64
+}
+
+func newStats() *stats {
+	return &stats{classes: map[string]*usage{}}
+}
+
+func (s *stats) merge(o *stats) {
+	s.add(o.usage)
+	for class, u := range o.classes {
+		c, ok := s.classes[class]
+		if !ok {
+			c = &usage{}
+			s.classes[class] = c
+		}
+		c.add(*u)
+	}
+	s.sizes = append(s.sizes, o.sizes...)
+}
+
+func (s *stats) addObject(obj types.Object) {
+	o := usage{count: 1, size: *obj.Size}
+	s.add(o)
+	class := string(obj.StorageClass)
+	u, ok := s.classes[class]
+	if !ok {
+		u = &usage{}
+		s.classes[class] = u
+	}
+	u.add(o)
+	if showPercentiles {
+		s.sizes = append(s.sizes, o.size)
+	}
+}
+
+// percentileRanks are the percentiles reported by -percentiles.
+var percentileRanks = []int{50, 90, 95, 99}
+
+// percentiles returns the size percentiles of percentileRanks and the
+// largest size of the matched objects, using the nearest rank. It sorts the
+// recorded sizes.
+func (s *stats) percentiles() (map[int]int64, int64) {
+	if len(s.sizes) == 0 {
+		return nil, 0
+	}
+	slices.Sort(s.sizes)
+	p := make(map[int]int64, len(percentileRanks))
+	for _, rank := range percentileRanks {
+		i := (rank*len(s.sizes)+99)/100 - 1
+		p[rank] = s.sizes[max(i, 0)]
+	}
+	return p, s.sizes[len(s.sizes)-1]
+}
+
+// printPercentiles prints the count and size of the matched objects along
+// with their size percentiles.
+func printPercentiles(w io.Writer, s *stats) {
+	fmt.Fprintf(w, "%d objects, %s", s.count, byteCountIEC(s.size))
+	p, largest := s.percentiles()
+	if p != nil {
+		for _, rank := range percentileRanks {
+			fmt.Fprintf(w, ", p%d %s", rank, byteCountIEC(p[rank]))
+		}
+		fmt.Fprintf(w, ", max %s", byteCountIEC(largest))
+	}
+	fmt.Fprintln(w)
+}
+
+// sortedClasses returns the storage classes seen, in alphabetical order.
+func (s *stats) sortedClasses() []string {
+	classes := make([]string, 0, len(s.classes))
+	for class := range s.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// sumPrefix returns the count and size of the matched objects of bucket
+// below prefix.
+func sumPrefix(ctx context.Context, client *s3.Client, bucket, prefix string) (usage, error) {
+	var total usage
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return total, err
+		}
+		for _, obj := range page.Contents {
+			if matchObject(bucket, obj) {
+				total.add(usage{count: 1, size: *obj.Size})
+			}
+		}
+	}
+	return total, nil
+}
+
+// diskUsage walks the common prefixes below prefix, printing the total size
+// of each one up to maxDepth levels deep, like `du --max-depth`. Everything
+// deeper than maxDepth is aggregated into its parent at the deepest level.
+func diskUsage(ctx context.Context, client *s3.Client, bucket, prefix string, depth int) (usage, error) {
+	if depth >= maxDepth {
+		return sumPrefix(ctx, client, bucket, prefix)
+	}
+
+	var total usage
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    &bucket,
+		Prefix:    &prefix,
+		Delimiter: &delimiter,
+	})
+	for paginator.HasMorePages() {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return total, err
+		}
+		for _, obj := range page.Contents {
+			if matchObject(bucket, obj) {
+				total.add(usage{count: 1, size: *obj.Size})
+			}
+		}
+		for _, p := range page.CommonPrefixes {
+			sub, err := diskUsage(ctx, client, bucket, *p.Prefix, depth+1)
+			if err != nil {
+				return total, err
+			}
+			printUsage(sub, bucket, *p.Prefix)
+			total.add(sub)
+		}
+	}
+	return total, nil
+}
+
+func printUsage(u usage, bucket, prefix string) {
+	name := displayKey(bucket, prefix)
+	if name == "" {
+		name = "."
+	}
+	fmt.Printf("%*s %s\n", sizeWidth, byteCountIEC(u.size), name)
+}
+
+// prefixUsage is the usage of a single common prefix.
+type prefixUsage struct {
+	prefix string
+	usage
+}
+
+// listCommonPrefixes returns the common prefixes of bucket directly below
+// prefix, using delim as delimiter.
+func listCommonPrefixes(ctx context.Context, client *s3.Client, bucket, prefix, delim string) ([]string, error) {
+	var prefixes []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    &bucket,
+		Prefix:    &prefix,
+		Delimiter: &delim,
+	})
+	for paginator.HasMorePages() {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, *p.Prefix)
+		}
+	}
+	return prefixes, nil
+}
+
+// summarizePrefixes returns the usage of each common prefix of bucket
+// directly below prefix, largest first. The prefixes are summed using up to
+// -concurrency listings in parallel.
+func summarizePrefixes(ctx context.Context, client *s3.Client, bucket, prefix string) ([]prefixUsage, error) {
+	prefixes, err := listCommonPrefixes(ctx, client, bucket, prefix, delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]prefixUsage, len(prefixes))
+	err = forEach(len(prefixes), func(i int) error {
+		var err error
+		summaries[i].prefix = prefixes[i]
+		summaries[i].usage, err = sumPrefix(ctx, client, bucket, prefixes[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].size > summaries[j].size
+	})
+	return summaries, nil
+}
+
+func printPrefixSummary(summaries []prefixUsage, bucket string) {
+	for _, s := range summaries {
+		fmt.Printf("%*s %10d %s\n", sizeWidth, byteCountIEC(s.size), s.count, displayKey(bucket, s.prefix))
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// unknownSizes counts the versions listed without a size and not fetched
+// with -head-if-missing-size. They are counted as empty.
+var unknownSizes atomic.Int64
+
+// listVersions lists the object versions of bucket below prefix, writing the
+// matched ones to out and adding them to total. Delete markers are skipped.
+func listVersions(ctx context.Context, client *s3.Client, bucket, prefix string, out objectWriter, total *stats) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	if delimiter != "" {
+		input.Delimiter = &delimiter
+	}
+	paginator := s3.NewListObjectVersionsPaginator(client, input)
+
+	for n := 1; paginator.HasMorePages(); n++ {
+		page, err := nextPage(ctx, paginator)
+		if err != nil {
+			return err
+		}
+		if showPages {
+			logPage(bucket, prefix, n, len(page.Versions), len(page.CommonPrefixes), aws.ToBool(page.IsTruncated),
+				fmt.Sprintf("key marker %s, version marker %s", aws.ToString(page.NextKeyMarker), aws.ToString(page.NextVersionIdMarker)))
+		}
+		for _, prefix := range page.CommonPrefixes {
+			if err := out.WritePrefix(bucket, *prefix.Prefix); err != nil {
+				return err
+			}
+		}
+		if onlyPrefixes {
+			continue
+		}
+		objs := make([]object, len(page.Versions))
+		for i, v := range page.Versions {
+			objs[i] = versionObject(bucket, v)
+		}
+		if deletesVersions() {
+			objs = deletableVersions(objs)
+		}
+		if err := fillSizes(ctx, client, objs); err != nil {
+			return err
+		}
+		budgetExhausted, err := processObjects(ctx, client, objs, out, total)
+		if err != nil {
+			return err
+		}
+		if budgetExhausted {
+			break
+		}
+		if deletesVersions() && !dryRun {
+			checkDeletionPace(aws.ToBool(page.IsTruncated))
+		}
+	}
+	return nil
+}
+
+// versionObject converts a listed version of bucket into an object.
+func versionObject(bucket string, v types.ObjectVersion) object {
+	return object{
+		Object: types.Object{
+			Key:          v.Key,
+			Size:         v.Size,
+			LastModified: v.LastModified,
+			ETag:         v.ETag,
+			StorageClass: types.ObjectStorageClass(v.StorageClass),
+		},
+		bucket:    bucket,
+		versionID: aws.ToString(v.VersionId),
+		isLatest:  aws.ToBool(v.IsLatest),
+	}
+}
+
+// fillSizes sets the missing sizes of objs, with a HeadObject request per
+// version when -head-if-missing-size is set, or to 0 otherwise.
+func fillSizes(ctx context.Context, client *s3.Client, objs []object) error {
+	var missing []int
+	for i, obj := range objs {
+		if obj.Size == nil {
+			missing = append(missing, i)
+		}
+	}
+	if !headIfMissingSize {
+		for _, i := range missing {
+			objs[i].Size = aws.Int64(0)
+		}
+		unknownSizes.Add(int64(len(missing)))
+		return nil
+	}
+	return forEach(len(missing), func(j int) error {
+		obj := &objs[missing[j]]
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    &obj.bucket,
+			Key:       obj.Key,
+			VersionId: &obj.versionID,
+		})
+		if err != nil {
+			return err
+		}
+		obj.Size = head.ContentLength
+		return nil
+	})
+}
+
+// warnUnknownSizes warns that the totals leave out the versions listed
+// without a size.
+func warnUnknownSizes() {
+	if n := unknownSizes.Load(); n > 0 {
+		log.Printf("warning: %d versions were listed without a size and count as empty, use -head-if-missing-size to fetch them", n)
+	}
+}
+
+// deletesVersions reports whether -delete-versions-older-than was requested.
+func deletesVersions() bool {
+	return deleteVersionsAge > 0
+}
+
+// deletableVersions returns the versions of objs that
+// -delete-versions-older-than may delete: never the latest ones, and only
+// those modified longer than its duration ago.
+func deletableVersions(objs []object) []object {
+	var deletable []object
+	for _, obj := range objs {
+		if !obj.isLatest && startTime.Sub(*obj.LastModified) > deleteVersionsAge {
+			deletable = append(deletable, obj)
+		}
+	}
+	return deletable
+}
+
+// deletedVersions and failedDeletes count the versions deleted and those
+// that could not be. deleteEstimate is how many are to be deleted, when the
+// confirmation preview counted them all.
+var (
+	deletedVersions atomic.Int64
+	failedDeletes   atomic.Int64
+	deleteEstimate  int64
+)
+
+// deleteVersion is the enricher deleting the noncurrent version obj. Versions
+// failing to delete are logged and counted in failedDeletes, and their errors
+// skipped rather than stopping the listing.
+func deleteVersion(ctx context.Context, client *s3.Client, obj *object) error {
+	if obj.isLatest || obj.versionID == "" {
+		// deletableVersions never lets the latest versions through.
+		return fmt.Errorf("refusing to delete the latest version of s3://%s/%s", obj.bucket, *obj.Key)
+	}
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    &obj.bucket,
+		Key:       obj.Key,
+		VersionId: &obj.versionID,
+	})
+	deletions.add(obj, err)
+	if err != nil {
+		log.Printf("error: failed to delete version %s of s3://%s/%s: %v", obj.versionID, obj.bucket, printedKey(*obj.Key), err)
+		failedDeletes.Add(1)
+		return skippedError{err}
+	}
+	deletedVersions.Add(1)
+	return nil
+}
+
+// duplicateVersionsWriter passes the versions along to w and, when closed,
+// warns about the keys having several versions with the same size and ETag.
+// Those are likely identical content uploaded again, each copy wasting its
+// size.
+type duplicateVersionsWriter struct {
+	w objectWriter
+
+	// copies counts the versions by key and content.
+	copies map[versionContent]int64
+}
+
+// versionContent identifies the content of a version of a key.
+type versionContent struct {
+	bucket, key, etag string
+	size              int64
+}
+
+func newDuplicateVersionsWriter(w objectWriter) *duplicateVersionsWriter {
+	return &duplicateVersionsWriter{w: w, copies: map[versionContent]int64{}}
+}
+
+func (d *duplicateVersionsWriter) Write(obj object) error {
+	if obj.ETag != nil {
+		d.copies[versionContent{obj.bucket, *obj.Key, *obj.ETag, *obj.Size}]++
+	}
+	return d.w.Write(obj)
+}
+
+func (d *duplicateVersionsWriter) WritePrefix(bucket, prefix string) error {
+	return d.w.WritePrefix(bucket, prefix)
+}
+
+// Close closes w first, so that the warnings follow the listing.
+func (d *duplicateVersionsWriter) Close() error {
+	if err := d.w.Close(); err != nil {
+		return err
+	}
+	var duplicates []versionContent
+	for content, n := range d.copies {
+		if n > 1 {
+			duplicates = append(duplicates, content)
+		}
+	}
+	slices.SortFunc(duplicates, func(a, b versionContent) int {
+		return cmp.Or(strings.Compare(a.bucket, b.bucket), strings.Compare(a.key, b.key), strings.Compare(a.etag, b.etag))
+	})
+	var wasted int64
+	for _, content := range duplicates {
+		n := d.copies[content]
+		wasted += (n - 1) * content.size
+		log.Printf("warning: s3://%s/%s has %d versions with the same content (%s, ETag %s), wasting %s",
+			content.bucket, printedKey(content.key), n, byteCountIEC(content.size), strings.Trim(content.etag, `"`), byteCountIEC((n-1)*content.size))
+	}
+	if len(duplicates) > 0 {
+		log.Printf("warning: %d keys have duplicate versions, wasting %s", len(duplicates), byteCountIEC(wasted))
+	}
+	return nil
+}
+
+// deleteResult is the outcome of the deletion of a version, for
+// -delete-report.
+type deleteResult struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionID string `json:"version_id"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error,omitempty"`
+}
+
+// deleteReport collects the deletion results written to -delete-report.
+type deleteReport struct {
+	mu      sync.Mutex
+	deleted []deleteResult
+	failed  []deleteResult
+}
+
+// deletions is the report of this run, when -delete-report is set.
+var deletions *deleteReport
+
+func (r *deleteReport) add(obj *object, err error) {
+	if r == nil {
+		return
+	}
+	result := deleteResult{Bucket: obj.bucket, Key: *obj.Key, VersionID: obj.versionID, Size: aws.ToInt64(obj.Size)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		result.Error = err.Error()
+		r.failed = append(r.failed, result)
+		return
+	}
+	r.deleted = append(r.deleted, result)
+}
+
+// write writes the report to path, as JSON when it ends with .json and as
+// CSV otherwise, sorted by key, along with the totals.
+func (r *deleteReport) write(path string) error {
+	// The deletions may still be running when interrupted.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byKey := func(a, b deleteResult) int {
+		return cmp.Or(strings.Compare(a.Bucket, b.Bucket), strings.Compare(a.Key, b.Key), strings.Compare(a.VersionID, b.VersionID))
+	}
+	slices.SortFunc(r.deleted, byKey)
+	slices.SortFunc(r.failed, byKey)
+	var deletedBytes int64
+	for _, d := range r.deleted {
+		deletedBytes += d.Size
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".json") {
+		report := struct {
+			Deleted []deleteResult `json:"deleted"`
+			Failed  []deleteResult `json:"failed"`
+			Totals  struct {
+				Deleted      int   `json:"deleted"`
+				DeletedBytes int64 `json:"deleted_bytes"`
+				Failed       int   `json:"failed"`
+			} `json:"totals"`
+		}{Deleted: append([]deleteResult{}, r.deleted...), Failed: append([]deleteResult{}, r.failed...)}
+		report.Totals.Deleted = len(r.deleted)
+		report.Totals.DeletedBytes = deletedBytes
+		report.Totals.Failed = len(r.failed)
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"status", "bucket", "key", "version_id", "size", "error"})
+	for _, d := range r.deleted {
+		w.Write([]string{"deleted", d.Bucket, d.Key, d.VersionID, strconv.FormatInt(d.Size, 10), ""})
+	}
+	for _, d := range r.failed {
+		w.Write([]string{"failed", d.Bucket, d.Key, d.VersionID, strconv.FormatInt(d.Size, 10), d.Error})
+	}
+	w.Write([]string{"total", "", "", "", strconv.FormatInt(deletedBytes, 10), fmt.Sprintf("%d deleted, %d failed", len(r.deleted), len(r.failed))})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}